@@ -31,8 +31,9 @@ func NewMasterClient(config *config.ServerConfig) (*MasterClient, error) {
 		UserConfig: config,
 	}
 
-	clustProj := CheckProject(mc.UserConfig.Project)
-	if clustProj == nil {
+	// a cluster selected without a project is enough for cluster commands
+	clustProj := CheckProject(mc.UserConfig.GetCurrentProject())
+	if clustProj == nil && mc.UserConfig.GetCurrentCluster() == "" {
 		logrus.Warn("No context set; some commands will not work. Run `rancher login` again.")
 	}
 
@@ -64,7 +65,7 @@ func NewManagementClient(config *config.ServerConfig) (*MasterClient, error) {
 
 // NewClusterClient returns a new MasterClient with only the Cluster client
 func NewClusterClient(config *config.ServerConfig) (*MasterClient, error) {
-	clustProj := CheckProject(config.Project)
+	clustProj := CheckProject(config.GetCurrentProject())
 	if clustProj == nil {
 		return nil, errors.New("no context set")
 	}
@@ -82,7 +83,7 @@ func NewClusterClient(config *config.ServerConfig) (*MasterClient, error) {
 
 // NewProjectClient returns a new MasterClient with only the Project client
 func NewProjectClient(config *config.ServerConfig) (*MasterClient, error) {
-	clustProj := CheckProject(config.Project)
+	clustProj := CheckProject(config.GetCurrentProject())
 	if clustProj == nil {
 		return nil, errors.New("no context set")
 	}
@@ -130,7 +131,7 @@ func (mc *MasterClient) newClusterClient() error {
 
 func (mc *MasterClient) newProjectClient() error {
 	options := createClientOpts(mc.UserConfig)
-	options.URL = options.URL + "/projects/" + mc.UserConfig.Project
+	options.URL = options.URL + "/projects/" + mc.UserConfig.GetCurrentProject()
 
 	// Setup the project client
 	pc, err := projectClient.NewClient(options)
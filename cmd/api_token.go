@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/rancher/norman/clientbase"
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+)
+
+// APITokenData is an API token of the user, from the v3 Management API or
+// ext.cattle.io/v1.
+type APITokenData struct {
+	Current     string `json:"-"`
+	IsCurrent   bool   `json:"current"`
+	ID          string `json:"id"`
+	Token       string `json:"token,omitempty"`
+	Description string `json:"description"`
+	Cluster     string `json:"cluster,omitempty"`
+	ExpiresAt   string `json:"expiresAt,omitempty"`
+	Expires     string `json:"-"`
+	Expired     bool   `json:"expired"`
+	LastUsedAt  string `json:"lastUsedAt,omitempty"`
+	LastUsed    string `json:"-"`
+}
+
+// tokenListFunc lists the v3 Norman tokens of the user.
+type tokenListFunc func() ([]managementClient.Token, error)
+
+// extTokenListerFunc lists the ext.cattle.io/v1 Tokens of the user.
+type extTokenListerFunc func(ctx context.Context) ([]extv1.Token, error)
+
+const (
+	// tokenKindLabel is the label of the tokens Rancher generates for a
+	// purpose, such as the kubeconfig tokens.
+	tokenKindLabel = "authn.management.cattle.io/kind"
+	// extSessionTokenKind is the kind of the ext tokens of login sessions.
+	extSessionTokenKind = "session"
+)
+
+// serverTokenAPI calls the token APIs of the current server with its API
+// token.
+type serverTokenAPI struct {
+	serverConfig *config.ServerConfig
+	// bearerToken intentionally keeps any "ext/" prefix on AccessKey because
+	// the ext API authenticator parses the prefix back out of the Bearer header.
+	bearerToken string
+	baseURL     string
+	client      *http.Client
+}
+
+func APITokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "api-token",
+		Aliases: []string{"api-tokens"},
+		Usage:   "Operations on the API tokens of the Rancher account",
+		Action:  defaultAction(apiTokenLs),
+		Commands: []*cli.Command{
+			{
+				Name:        "ls",
+				Usage:       "List API tokens",
+				Description: "Lists the API tokens of the current user, marking the one of the current server config. The tokens of login sessions and the kubeconfig tokens are only listed with --all",
+				ArgsUsage:   "None",
+				Action:      apiTokenLs,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Also list the tokens of login sessions and the kubeconfig tokens",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"o"},
+						Usage:   "'json', 'yaml' or custom format: '{{.ID}} {{.Description}} {{.Expires}}'",
+					},
+					quietFlag,
+				},
+			},
+			{
+				Name:        "create",
+				Usage:       "Create an API token",
+				Description: "Creates an API token for the current user, the token is only shown once",
+				ArgsUsage:   "None",
+				Action:      apiTokenCreate,
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "ttl",
+						Usage: "Time to live of the token, capped by the max TTL of the server, 0 for no expiration",
+					},
+					&cli.StringFlag{
+						Name:  "description",
+						Usage: "Description of the token",
+						Value: apiTokenDescription(),
+					},
+					// same as the global --cluster
+					&cli.StringFlag{
+						Name:   "cluster",
+						Usage:  "Scope the token to a cluster, by ID or name",
+						Hidden: true,
+					},
+					formatFlag,
+				},
+			},
+			{
+				Name:      "delete",
+				Aliases:   []string{"rm"},
+				Usage:     "Delete API tokens",
+				ArgsUsage: "[TOKENID...]",
+				Action:    apiTokenDelete,
+			},
+		},
+	}
+}
+
+// newServerTokenAPI returns what's needed to call the token APIs of the
+// current server directly, with its API token.
+func newServerTokenAPI(cmd *cli.Command) (*serverTokenAPI, error) {
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	serverConfig, err := cf.GetCurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	return serverTokenAPIFor(serverConfig)
+}
+
+// serverTokenAPIFor returns what's needed to call the token APIs of the
+// server of serverConfig directly, with its API token.
+func serverTokenAPIFor(serverConfig *config.ServerConfig) (*serverTokenAPI, error) {
+	// Norman's MasterClient does not expose its underlying http.Client, so
+	// build a parallel one here for the direct API calls.
+	client, err := newServerHTTPClient(serverConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP client: %w", err)
+	}
+	baseURL, err := serverConfig.EnvironmentURL()
+	if err != nil {
+		return nil, fmt.Errorf("error resolving server base URL: %w", err)
+	}
+
+	return &serverTokenAPI{
+		serverConfig: serverConfig,
+		bearerToken:  serverConfig.AccessKey + ":" + serverConfig.SecretKey,
+		baseURL:      baseURL,
+		client:       client,
+	}, nil
+}
+
+func apiTokenLs(ctx context.Context, cmd *cli.Command) error {
+	c, err := GetClient(cmd)
+	if err != nil {
+		return err
+	}
+	api, err := newServerTokenAPI(cmd)
+	if err != nil {
+		return err
+	}
+
+	v3List := func() ([]managementClient.Token, error) {
+		collection, err := c.ManagementClient.Token.ListAll(baseListOpts())
+		if err != nil {
+			return nil, err
+		}
+		return collection.Data, nil
+	}
+	extList := func(ctx context.Context) ([]extv1.Token, error) {
+		return listExtTokens(ctx, api.baseURL, api.bearerToken, api.client)
+	}
+
+	tokens, err := listAPITokens(ctx, v3List, extList, api.serverConfig.AccessKey, cmd.Bool("all"))
+	if err != nil {
+		return err
+	}
+
+	writer := NewTableWriter([][]string{
+		{"CURRENT", "Current"},
+		{"ID", "ID"},
+		{"DESCRIPTION", "Description"},
+		{"CLUSTER", "Cluster"},
+		{"EXPIRES", "Expires"},
+		{"LAST USED", "LastUsed"},
+	}, cmd)
+	defer writer.Close()
+
+	for _, token := range tokens {
+		writer.Write(token)
+	}
+	return writer.Err()
+}
+
+// listAPITokens lists the tokens of the user from both token APIs, either of
+// them being skipped when it's not served. Ids of ext tokens are prefixed with
+// "ext/", like the access keys stored in the config, so that the token with
+// the id currentID is marked as the current one. The tokens of login sessions
+// and the kubeconfig tokens, which aren't API tokens created by the user, are
+// skipped unless all is set.
+func listAPITokens(ctx context.Context, v3List tokenListFunc, extList extTokenListerFunc, currentID string, all bool) ([]*APITokenData, error) {
+	var tokens []*APITokenData
+
+	v3Tokens, err := v3List()
+	if err != nil && !clientbase.IsNotFound(err) {
+		return nil, err
+	}
+	for _, token := range v3Tokens {
+		generated := !token.IsDerived || token.Labels[tokenKindLabel] == "kubeconfig"
+		if generated && !all && token.ID != currentID {
+			continue
+		}
+		tokens = append(tokens, newAPITokenData(token.ID, token.Description, token.ClusterID, token.ExpiresAt, token.Expired, token.LastUsedAt))
+	}
+
+	extTokens, err := extList(ctx)
+	if err != nil && !clientbase.IsNotFound(err) {
+		return nil, err
+	}
+	for _, token := range extTokens {
+		generated := token.Spec.Kind == extSessionTokenKind || token.Labels[tokenKindLabel] == "kubeconfig"
+		if generated && !all && extTokenIDPrefix+token.Name != currentID {
+			continue
+		}
+		var lastUsedAt string
+		if token.Status.LastUsedAt != nil {
+			lastUsedAt = token.Status.LastUsedAt.UTC().Format(time.RFC3339)
+		}
+		tokens = append(tokens, newAPITokenData(extTokenIDPrefix+token.Name, token.Spec.Description, token.Spec.ClusterName, token.Status.ExpiresAt, token.Status.Expired, lastUsedAt))
+	}
+
+	for _, token := range tokens {
+		if token.ID == currentID {
+			token.IsCurrent = true
+			token.Current = "*"
+		}
+	}
+	return tokens, nil
+}
+
+func newAPITokenData(id, description, cluster, expiresAt string, expired bool, lastUsedAt string) *APITokenData {
+	data := &APITokenData{
+		ID:          id,
+		Description: description,
+		Cluster:     cluster,
+		ExpiresAt:   expiresAt,
+		Expires:     "never",
+		Expired:     expired,
+		LastUsedAt:  lastUsedAt,
+		LastUsed:    "-",
+	}
+	if expiresAt != "" {
+		data.Expires = formatTokenTime(expiresAt)
+	}
+	if expired {
+		data.Expires = "expired"
+	}
+	if lastUsedAt != "" {
+		data.LastUsed = formatTokenTime(lastUsedAt)
+	}
+	return data
+}
+
+// formatTokenTime formats the timestamps of the token APIs in local time.
+func formatTokenTime(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ts
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func apiTokenCreate(ctx context.Context, cmd *cli.Command) error {
+	api, err := newServerTokenAPI(cmd)
+	if err != nil {
+		return err
+	}
+
+	spec := apiTokenSpec{
+		Description: cmd.String("description"),
+		TTL:         cmd.Duration("ttl"),
+	}
+	if spec.TTL < 0 {
+		return errors.New("the TTL can't be negative")
+	}
+	// the token is only scoped to the cluster selected with --cluster, not
+	// to the cluster of the current context
+	if configOverrides(cmd).Cluster != "" {
+		c, err := GetClient(cmd)
+		if err != nil {
+			return err
+		}
+		spec.ClusterID = c.UserConfig.GetCurrentCluster()
+	}
+
+	token, err := createAPIToken(api.client, api.baseURL, api.bearerToken, spec)
+	if err != nil {
+		return err
+	}
+	id, _, _ := strings.Cut(token.BearerToken, ":")
+
+	writer := NewTableWriter([][]string{
+		{"ID", "ID"},
+		{"TOKEN", "Token"},
+		{"EXPIRES", "Expires"},
+	}, cmd)
+	defer writer.Close()
+
+	data := newAPITokenData(id, spec.Description, spec.ClusterID, token.ExpiresAt, false, "")
+	data.Token = token.BearerToken
+	writer.Write(data)
+	if err := writer.Err(); err != nil {
+		return err
+	}
+	if cmd.String("format") == "" {
+		customPrint("Save the token now, it can't be shown again.")
+	}
+	return nil
+}
+
+func apiTokenDelete(ctx context.Context, cmd *cli.Command) error {
+	if cmd.NArg() == 0 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	api, err := newServerTokenAPI(cmd)
+	if err != nil {
+		return err
+	}
+	v3Delete := func(ctx context.Context, id, bearer string) error {
+		return deleteV3Token(ctx, id, api.baseURL, bearer, api.client)
+	}
+	extDelete := func(ctx context.Context, id, bearer string) error {
+		return deleteExtToken(ctx, id, api.baseURL, bearer, api.client)
+	}
+
+	for _, id := range cmd.Args().Slice() {
+		deleted, err := revokeTokenWith(ctx, id, api.bearerToken, v3Delete, extDelete)
+		if err != nil {
+			return fmt.Errorf("error deleting token %s: %w", id, err)
+		}
+		if !deleted {
+			return fmt.Errorf("token %s not found", id)
+		}
+		if id == api.serverConfig.AccessKey {
+			logrus.Warnf("Deleted the API token of the current server, run 'rancher login' to log in again")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/rancher/norman/clientbase"
+	"github.com/rancher/norman/types"
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListAPITokens(t *testing.T) {
+	t.Parallel()
+
+	lastUsed := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	v3Tokens := []managementClient.Token{
+		{
+			Resource:    types.Resource{ID: "token-abcde"},
+			Description: "Rancher CLI on laptop",
+			ExpiresAt:   "2030-02-01T00:00:00Z",
+			LastUsedAt:  "2030-01-02T03:04:05Z",
+			IsDerived:   true,
+		},
+		{
+			Resource:  types.Resource{ID: "kubeconfig-u-abcde"},
+			ClusterID: "c-12345",
+			ExpiresAt: "2029-01-01T00:00:00Z",
+			Expired:   true,
+			IsDerived: true,
+			Labels:    map[string]string{tokenKindLabel: "kubeconfig"},
+		},
+		{
+			Resource: types.Resource{ID: "token-session"},
+		},
+	}
+	extTokens := []extv1.Token{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "token-fghij"},
+			Spec:       extv1.TokenSpec{Description: "ci"},
+			Status:     extv1.TokenStatus{LastUsedAt: &metav1.Time{Time: lastUsed}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "token-klmno"},
+			Spec:       extv1.TokenSpec{Kind: extSessionTokenKind},
+		},
+	}
+	notFound := &clientbase.APIError{StatusCode: http.StatusNotFound}
+
+	tests := []struct {
+		name        string
+		v3Err       error
+		extErr      error
+		currentID   string
+		all         bool
+		expectedIDs []string
+		expectedErr string
+	}{
+		{
+			name:        "both APIs",
+			currentID:   "token-abcde",
+			expectedIDs: []string{"token-abcde", "ext/token-fghij"},
+		},
+		{
+			name:        "all tokens",
+			currentID:   "token-abcde",
+			all:         true,
+			expectedIDs: []string{"token-abcde", "kubeconfig-u-abcde", "token-session", "ext/token-fghij", "ext/token-klmno"},
+		},
+		{
+			name:        "current session token",
+			currentID:   "ext/token-klmno",
+			expectedIDs: []string{"token-abcde", "ext/token-fghij", "ext/token-klmno"},
+		},
+		{
+			name:        "v3 not served",
+			v3Err:       notFound,
+			currentID:   "ext/token-fghij",
+			expectedIDs: []string{"ext/token-fghij"},
+		},
+		{
+			name:        "ext not served",
+			extErr:      notFound,
+			expectedIDs: []string{"token-abcde"},
+		},
+		{
+			name:        "ext error",
+			extErr:      &clientbase.APIError{StatusCode: http.StatusForbidden, Msg: "forbidden"},
+			expectedErr: "forbidden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v3List := func() ([]managementClient.Token, error) {
+				if tt.v3Err != nil {
+					return nil, tt.v3Err
+				}
+				return v3Tokens, nil
+			}
+			extList := func(context.Context) ([]extv1.Token, error) {
+				if tt.extErr != nil {
+					return nil, tt.extErr
+				}
+				return extTokens, nil
+			}
+
+			tokens, err := listAPITokens(context.Background(), v3List, extList, tt.currentID, tt.all)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var ids, current []string
+			for _, token := range tokens {
+				ids = append(ids, token.ID)
+				if token.IsCurrent {
+					assert.Equal(t, "*", token.Current)
+					current = append(current, token.ID)
+				}
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+			if tt.currentID != "" {
+				assert.Equal(t, []string{tt.currentID}, current)
+			} else {
+				assert.Empty(t, current)
+			}
+		})
+	}
+
+	tokens, err := listAPITokens(context.Background(), func() ([]managementClient.Token, error) { return v3Tokens, nil }, func(context.Context) ([]extv1.Token, error) { return extTokens, nil }, "", true)
+	require.NoError(t, err)
+	require.Len(t, tokens, 5)
+
+	assert.Equal(t, time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC).Local().Format(time.RFC3339), tokens[0].Expires)
+	assert.Equal(t, lastUsed.Local().Format(time.RFC3339), tokens[0].LastUsed)
+	assert.Equal(t, "expired", tokens[1].Expires)
+	assert.Equal(t, "c-12345", tokens[1].Cluster)
+	assert.Equal(t, "-", tokens[1].LastUsed)
+	assert.Equal(t, "never", tokens[3].Expires)
+	assert.Equal(t, "2030-01-02T03:04:05Z", tokens[3].LastUsedAt)
+}
+
+func TestListExtTokens(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/apis/ext.cattle.io/v1/tokens", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer ext/token-abcde:secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"apiVersion":"ext.cattle.io/v1","kind":"TokenList","items":[{"metadata":{"name":"token-abcde"},"spec":{"description":"ci"}}]}`))
+	}))
+	defer server.Close()
+
+	tokens, err := listExtTokens(context.Background(), server.URL, "ext/token-abcde:secret", server.Client())
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "token-abcde", tokens[0].Name)
+	assert.Equal(t, "ci", tokens[0].Spec.Description)
+
+	// the 404 of servers without the ext API is left unwrapped for IsNotFound
+	_, err = listExtTokens(context.Background(), server.URL, "token-abcde:secret", server.Client())
+	assert.True(t, clientbase.IsNotFound(err))
+}
+
+func TestServerTokenAPIForCACerts(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/tokens", r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	// CACerts holds the PEM content of the CA, not a path
+	serverConfig := &config.ServerConfig{
+		URL:       server.URL,
+		AccessKey: "token-abcde",
+		SecretKey: "secret",
+		CACerts:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+	}
+	tokenAPI, err := serverTokenAPIFor(serverConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "token-abcde:secret", tokenAPI.bearerToken)
+
+	resp, err := tokenAPI.client.Get(server.URL + "/v3/tokens")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -13,6 +13,7 @@ import (
 	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v3"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
@@ -129,6 +130,14 @@ func ClusterCommand() *cli.Command {
 				Usage:     "Return the kube config used to access the cluster",
 				ArgsUsage: "[CLUSTERID CLUSTERNAME]",
 				Action:    clusterKubeConfig,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name: "endpoint",
+						Usage: "Set the current context to the endpoint reaching the cluster: 'rancher' for the Rancher proxy, " +
+							"'ace' for the authorized cluster endpoint, or 'auto' for a reachable authorized cluster endpoint, " +
+							"falling back to the Rancher proxy",
+					},
+				},
 			},
 			{
 				Name:        "add-member-role",
@@ -437,6 +446,10 @@ func clusterKubeConfig(ctx context.Context, cmd *cli.Command) error {
 	if cmd.NArg() == 0 {
 		return cli.ShowSubcommandHelp(cmd)
 	}
+	endpoint := cmd.String("endpoint")
+	if err := validateKubeEndpoint(endpoint); err != nil {
+		return err
+	}
 
 	c, err := GetClient(cmd)
 	if err != nil {
@@ -457,7 +470,23 @@ func clusterKubeConfig(ctx context.Context, cmd *cli.Command) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println(config.Config)
+	if endpoint == "" {
+		fmt.Println(config.Config)
+		return nil
+	}
+
+	kubeConfig, err := clientcmd.Load([]byte(config.Config))
+	if err != nil {
+		return err
+	}
+	if kubeConfig, err = selectKubeEndpoint(ctx, kubeConfig, endpoint, probeKubeEndpoint); err != nil {
+		return err
+	}
+	out, err := clientcmd.Write(*kubeConfig)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
 	return nil
 }
 
@@ -61,6 +61,28 @@ func (f *fakePRTBLister) List(opts *types.ListOpts) (*managementClient.ProjectRo
 	return nil, nil
 }
 
+type fakeUserGetter struct {
+	ByIDFunc func(id string) (*managementClient.User, error)
+}
+
+func (g *fakeUserGetter) ByID(id string) (*managementClient.User, error) {
+	if g.ByIDFunc != nil {
+		return g.ByIDFunc(id)
+	}
+	return nil, nil
+}
+
+type fakeGRBLister struct {
+	ListFunc func(opts *types.ListOpts) (*managementClient.GlobalRoleBindingCollection, error)
+}
+
+func (f *fakeGRBLister) List(opts *types.ListOpts) (*managementClient.GlobalRoleBindingCollection, error) {
+	if f.ListFunc != nil {
+		return f.ListFunc(opts)
+	}
+	return nil, nil
+}
+
 func parseTabWriterOutput(r io.Reader) [][]string {
 	var parsed [][]string
 	scanner := bufio.NewScanner(r)
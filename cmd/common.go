@@ -178,38 +178,40 @@ func parsePrincipalID(principalID string) *managementClient.Principal {
 	}
 }
 
-func getKubeConfigForUser(cmd *cli.Command, user string) (*api.Config, error) {
+func getKubeConfigForUser(cmd *cli.Command, user, clusterID string) (*api.Config, *config.KubeConfigToken, error) {
 	cf, err := loadConfig(cmd)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	currentServer, err := cf.GetCurrentServer()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	kubeConfig := currentServer.KubeConfigs[fmt.Sprintf(kubeConfigKeyFormat, user, currentServer.GetCurrentCluster())]
-	return kubeConfig, nil
+	key := fmt.Sprintf(kubeConfigKeyFormat, user, clusterID)
+	return currentServer.KubeConfigs[key], currentServer.KubeConfigTokens[key], nil
 }
 
-func setKubeConfigForUser(cmd *cli.Command, user string, kubeConfig *api.Config) error {
-	cf, err := loadConfig(cmd)
-	if err != nil {
-		return err
-	}
-
-	currentServer, err := cf.GetCurrentServer()
-	if err != nil {
-		return err
-	}
+func setKubeConfigForUser(cmd *cli.Command, user, clusterID string, kubeConfig *api.Config, token *config.KubeConfigToken) error {
+	return updateConfig(cmd, func(cf *config.Config) error {
+		currentServer, err := cf.GetCurrentServer()
+		if err != nil {
+			return err
+		}
 
-	if currentServer.KubeConfigs == nil {
-		currentServer.KubeConfigs = make(map[string]*api.Config)
-	}
+		if currentServer.KubeConfigs == nil {
+			currentServer.KubeConfigs = make(map[string]*api.Config)
+		}
+		if currentServer.KubeConfigTokens == nil {
+			currentServer.KubeConfigTokens = make(map[string]*config.KubeConfigToken)
+		}
 
-	currentServer.KubeConfigs[fmt.Sprintf(kubeConfigKeyFormat, user, currentServer.GetCurrentCluster())] = kubeConfig
-	return cf.Write()
+		key := fmt.Sprintf(kubeConfigKeyFormat, user, clusterID)
+		currentServer.KubeConfigs[key] = kubeConfig
+		currentServer.KubeConfigTokens[key] = token
+		return nil
+	})
 }
 
 func searchForMember(cmd *cli.Command, c *cliclient.MasterClient, name string) (*managementClient.Principal, error) {
@@ -288,7 +290,41 @@ func GetConfigPath(cmd *cli.Command) string {
 
 func loadConfig(cmd *cli.Command) (config.Config, error) {
 	path := GetConfigPath(cmd)
-	return config.LoadFromPath(path)
+	cf, err := config.LoadFromPath(path)
+	if err != nil {
+		return cf, err
+	}
+	cf.SetOverrides(configOverrides(cmd))
+	return cf, nil
+}
+
+// updateConfig is like config.Update, with the global overrides applied to
+// the config passed to fn.
+func updateConfig(cmd *cli.Command, fn func(*config.Config) error) error {
+	return config.Update(GetConfigPath(cmd), func(cf *config.Config) error {
+		cf.SetOverrides(configOverrides(cmd))
+		return fn(cf)
+	})
+}
+
+// configOverrides returns the server, context and cluster selected with the
+// global flags, or with the hidden local flags of the same names kept for
+// compatibility.
+func configOverrides(cmd *cli.Command) config.Overrides {
+	return config.Overrides{
+		Server:  overrideFlag(cmd, "server"),
+		Context: overrideFlag(cmd, "context"),
+		Cluster: overrideFlag(cmd, "cluster"),
+	}
+}
+
+// overrideFlag returns the value of a global flag, unless a local flag with
+// the same name shadows it and is set.
+func overrideFlag(cmd *cli.Command, name string) string {
+	if cmd.IsSet(name) {
+		return cmd.String(name)
+	}
+	return cmd.Root().String(name)
 }
 
 func lookupConfig(cmd *cli.Command) (*config.ServerConfig, error) {
@@ -311,6 +347,13 @@ func GetClient(cmd *cli.Command) (*cliclient.MasterClient, error) {
 		return nil, err
 	}
 
+	// --cluster selects a cluster without a project
+	if cf.GetCurrentProject() == "" && cf.GetCurrentCluster() != "" {
+		if err := resolveClusterOverride(cmd, cf); err != nil {
+			return nil, err
+		}
+	}
+
 	mc, err := cliclient.NewMasterClient(cf)
 	if err != nil {
 		return nil, err
@@ -319,6 +362,38 @@ func GetClient(cmd *cli.Command) (*cliclient.MasterClient, error) {
 	return mc, nil
 }
 
+// resolveClusterOverride overrides the context of the server with the ID of
+// the current cluster, which may be given by name, and its Default project or
+// its only project. The project is left empty when there is none to pick, the
+// commands needing one fail and --context selects it.
+func resolveClusterOverride(cmd *cli.Command, sc *config.ServerConfig) error {
+	c, err := cliclient.NewManagementClient(sc)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := Lookup(c, sc.GetCurrentCluster(), "cluster")
+	if err != nil {
+		return err
+	}
+
+	filter := defaultListOpts(cmd)
+	filter.Filters["clusterId"] = cluster.ID
+	projects, err := c.ManagementClient.Project.List(filter)
+	if err != nil {
+		return err
+	}
+
+	var project string
+	for _, p := range projects.Data {
+		if p.Name == "Default" || len(projects.Data) == 1 {
+			project = p.ID
+			break
+		}
+	}
+	return sc.OverrideContext(project, cluster.ID)
+}
+
 // GetResourceType maps an incoming resource type to a valid one from the schema
 func GetResourceType(c *cliclient.MasterClient, resource string) (string, error) {
 	if c.ManagementClient != nil {
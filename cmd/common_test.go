@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
 )
 
 func TestParseClusterAndProjectID(t *testing.T) {
@@ -252,3 +254,61 @@ func TestNewHTTPClient(t *testing.T) {
 		require.Nil(t, proxyURL)
 	})
 }
+
+func TestConfigOverrides(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected config.Overrides
+	}{
+		{
+			name:     "global flags before the command",
+			args:     []string{"rancher", "--server", "rancher.example.com", "--cluster", "c-12345", "token"},
+			expected: config.Overrides{Server: "rancher.example.com", Cluster: "c-12345"},
+		},
+		{
+			name:     "global flags after the command",
+			args:     []string{"rancher", "token", "--server", "rancher.example.com", "--cluster", "c-12345"},
+			expected: config.Overrides{Server: "rancher.example.com", Cluster: "c-12345"},
+		},
+		{
+			name:     "global flag of a command with a local flag",
+			args:     []string{"rancher", "--context", "c-12345:p-12345", "login"},
+			expected: config.Overrides{Context: "c-12345:p-12345"},
+		},
+		{
+			name:     "hidden local flag",
+			args:     []string{"rancher", "login", "--context", "c-12345:p-12345"},
+			expected: config.Overrides{Context: "c-12345:p-12345"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var overrides config.Overrides
+			action := func(_ context.Context, cmd *cli.Command) error {
+				overrides = configOverrides(cmd)
+				return nil
+			}
+			root := &cli.Command{
+				Name: "rancher",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "server"},
+					&cli.StringFlag{Name: "context"},
+					&cli.StringFlag{Name: "cluster"},
+				},
+				Commands: []*cli.Command{CredentialCommand(), LoginCommand()},
+			}
+			for _, c := range root.Commands {
+				c.Action = action
+			}
+
+			require.NoError(t, root.Run(t.Context(), tt.args))
+			assert.Equal(t, tt.expected, overrides)
+		})
+	}
+}
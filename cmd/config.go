@@ -0,0 +1,377 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/cli/cliclient"
+	"github.com/rancher/cli/config"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+)
+
+const migrateSecretsDescription = `
+Moves the access keys, secret keys and cached kubeconfig tokens stored in the
+config file to a secret store. The config file only keeps references to them.
+
+The 'file' backend encrypts the secrets with a passphrase, read from the
+RANCHER_SECRETS_PASSPHRASE environment variable or asked for on the terminal.
+The 'keyring' backend uses the Keychain on macOS, the Secret Service
+(secret-tool) on Linux and the Credential Manager on Windows, its entries
+are named after the config directory so that several directories don't share
+them.
+
+Example:
+	# Move the secrets to an encrypted file
+	$ rancher config migrate-secrets --backend file
+`
+
+const validateDescription = `
+Checks the config file for fields unknown to this version of the CLI and for
+entries that can't be used anymore, such as a current server that doesn't
+exist or kube credentials cached for a server that isn't configured anymore,
+or was never logged in to.
+Older config files are migrated in memory before being checked, the migrated
+config is saved by the next command updating it.
+
+Example:
+	# Check the config file
+	$ rancher config validate
+`
+
+const viewDescription = `
+Displays the config file, or the config of a single server, with the secret
+keys and cached tokens redacted.
+
+Example:
+	# Show the config of all servers
+	$ rancher config view
+
+	# Show the config of the server named rancherDefault as json
+	$ rancher config view --format json rancherDefault
+`
+
+const setDescription = `
+Sets a field of a server config. The key is the name of the server and the
+name of the field, separated by a dot. The fields that can be set are:
+
+	url                 URL of the Rancher server
+	project             Current context, in the <cluster-id>:<project-id> format
+	cacert              Path to a PEM file, or PEM content, of the CA certificate of the server
+	proxyUrl            URL of the proxy used to reach the server
+	httpTimeoutSeconds  Timeout of the requests to the server, in seconds
+
+Example:
+	# Reach the server rancherDefault through a proxy
+	$ rancher config set rancherDefault.proxyUrl http://proxy.example.com:3128
+
+	# Trust the CA of the server rancherDefault
+	$ rancher config set rancherDefault.cacert ./ca.pem
+`
+
+const unsetDescription = `
+Resets a field of a server config to its default value. See 'rancher config set
+--help' for the list of fields.
+
+Example:
+	# Stop using a proxy to reach the server rancherDefault
+	$ rancher config unset rancherDefault.proxyUrl
+`
+
+// ConfigCommand defines the 'rancher config' sub-commands
+func ConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Operations on the local configuration",
+		Commands: []*cli.Command{
+			{
+				Name:        "migrate-secrets",
+				Usage:       "Move the secrets of the config file to a secret store",
+				Description: migrateSecretsDescription,
+				ArgsUsage:   "None",
+				Action:      configMigrateSecrets,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "backend",
+						Usage: "Secret store to use: 'file' or 'keyring'",
+						Value: config.SecretBackendFile,
+					},
+				},
+			},
+			{
+				Name:        "view",
+				Usage:       "Display the config with secrets redacted",
+				Description: viewDescription,
+				ArgsUsage:   "[SERVER]",
+				Action:      configView,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"o"},
+						Usage:   "'json' or 'yaml'",
+						Value:   "yaml",
+					},
+				},
+			},
+			{
+				Name:        "set",
+				Usage:       "Set a field of a server config",
+				Description: setDescription,
+				ArgsUsage:   "[SERVER.FIELD VALUE]",
+				Action:      configSet,
+			},
+			{
+				Name:        "unset",
+				Usage:       "Reset a field of a server config",
+				Description: unsetDescription,
+				ArgsUsage:   "[SERVER.FIELD]",
+				Action:      configUnset,
+			},
+			{
+				Name:        "validate",
+				Usage:       "Report unknown or orphaned entries of the config file",
+				Description: validateDescription,
+				ArgsUsage:   "None",
+				Action:      configValidate,
+			},
+		},
+	}
+}
+
+func configMigrateSecrets(ctx context.Context, cmd *cli.Command) error {
+	backend := cmd.String("backend")
+	if !slices.Contains(config.SecretBackends(), backend) {
+		return fmt.Errorf("invalid backend %q, must be one of: %s", backend, strings.Join(config.SecretBackends(), ", "))
+	}
+
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if len(cf.Servers) == 0 {
+		return errors.New("no servers are currently configured")
+	}
+	if cf.SecretBackend == backend {
+		logrus.Infof("Secrets are already stored in the %s backend", backend)
+		return nil
+	}
+
+	// the credential store is loaded with the current backend of the config
+	err = cf.UpdateCredentials(func(s *config.CredentialStore) error {
+		s.SetSecretBackend(backend)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cf.SecretBackend = backend
+	if err := cf.Write(); err != nil {
+		return err
+	}
+
+	logrus.Infof("Secrets of %d server(s) moved to the %s backend", len(cf.Servers), backend)
+	return nil
+}
+
+func configView(ctx context.Context, cmd *cli.Command) error {
+	format := cmd.String("format")
+	if format != "json" && format != "yaml" {
+		return fmt.Errorf("invalid format %q, must be 'json' or 'yaml'", format)
+	}
+
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	cf = cf.Redacted()
+
+	var view any = cf
+	if cmd.NArg() > 0 {
+		server := cf.Servers[cmd.Args().First()]
+		if server == nil {
+			return fmt.Errorf("server %s is not configured", cmd.Args().First())
+		}
+		view = server
+	}
+
+	writer := NewTableWriter(nil, cmd)
+	writer.Write(view)
+	writer.Close()
+
+	return writer.Err()
+}
+
+func configSet(ctx context.Context, cmd *cli.Command) error {
+	if cmd.NArg() != 2 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if err := setServerConfigField(&cf, cmd.Args().Get(0), cmd.Args().Get(1)); err != nil {
+		return err
+	}
+	return cf.Write()
+}
+
+func configUnset(ctx context.Context, cmd *cli.Command) error {
+	if cmd.NArg() != 1 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if err := setServerConfigField(&cf, cmd.Args().First(), ""); err != nil {
+		return err
+	}
+	return cf.Write()
+}
+
+// serverConfigFields maps the fields that can be edited with 'rancher config
+// set' to a func validating the value and setting it. An empty value unsets
+// the field.
+var serverConfigFields = map[string]func(sc *config.ServerConfig, value string) error{
+	"url": func(sc *config.ServerConfig, value string) error {
+		if value == "" {
+			return errors.New("url can't be unset, use 'rancher server delete' to remove the server")
+		}
+		u, err := url.ParseRequestURI(value)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid url %q, must be an http(s) URL (e.g. https://rancher.yourdomain.com)", value)
+		}
+		u.Path = ""
+		sc.URL = u.String()
+		return nil
+	},
+	"project": func(sc *config.ServerConfig, value string) error {
+		if value != "" && cliclient.CheckProject(value) == nil {
+			return fmt.Errorf("invalid project %q, must be in the <cluster-id>:<project-id> format", value)
+		}
+		sc.Project = value
+		return nil
+	},
+	"cacert": func(sc *config.ServerConfig, value string) error {
+		if value == "" {
+			sc.CACerts = ""
+			return nil
+		}
+		var (
+			cert string
+			err  error
+		)
+		if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+			cert, err = verifyCert([]byte(value))
+		} else {
+			cert, err = loadAndVerifyCert(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid cacert: %w", err)
+		}
+		sc.CACerts = cert
+		return nil
+	},
+	"proxyUrl": func(sc *config.ServerConfig, value string) error {
+		if value != "" {
+			u, err := url.Parse(value)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("invalid proxy URL %q, must be a URL such as http://proxy.example.com:3128", value)
+			}
+		}
+		sc.ProxyURL = value
+		return nil
+	},
+	"httpTimeoutSeconds": func(sc *config.ServerConfig, value string) error {
+		if value == "" {
+			sc.HTTPTimeoutSeconds = 0
+			return nil
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("invalid httpTimeoutSeconds %q, must be a positive number of seconds", value)
+		}
+		sc.HTTPTimeoutSeconds = seconds
+		return nil
+	},
+}
+
+// setServerConfigField sets the field of a server config identified by key,
+// in the <server>.<field> format. Server names can contain dots, the field is
+// what follows the last one.
+func setServerConfigField(cf *config.Config, key, value string) error {
+	i := strings.LastIndex(key, ".")
+	if i <= 0 || i == len(key)-1 {
+		return fmt.Errorf("invalid key %q, must be in the <server>.<field> format", key)
+	}
+	name, field := key[:i], key[i+1:]
+
+	set, ok := serverConfigFields[field]
+	if !ok {
+		fields := slices.Sorted(maps.Keys(serverConfigFields))
+		return fmt.Errorf("unknown field %q, must be one of: %s", field, strings.Join(fields, ", "))
+	}
+
+	server := cf.Servers[name]
+	if server == nil {
+		return fmt.Errorf("server %s is not configured", name)
+	}
+	return set(server, value)
+}
+
+func configValidate(ctx context.Context, cmd *cli.Command) error {
+	path := GetConfigPath(cmd)
+	problems, err := config.Validate(path)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Printf("%s is valid\n", path)
+		return nil
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	return fmt.Errorf("found %d problem(s) in %s", len(problems), path)
+}
+
+// SecretsPassphrase returns the passphrase of the file secret store. It's read
+// from RANCHER_SECRETS_PASSPHRASE, or asked for when a terminal is attached.
+func SecretsPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv("RANCHER_SECRETS_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("the secret store passphrase is required, set RANCHER_SECRETS_PASSPHRASE")
+	}
+
+	passphrase, err := customPrompt("Enter secret store passphrase: ", false)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("the secret store passphrase can't be empty")
+	}
+	if confirm {
+		again, err := customPrompt("Confirm secret store passphrase: ", false)
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetServerConfigField(t *testing.T) {
+	t.Parallel()
+
+	caCert := newTestCACert(t)
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caPath, []byte(caCert), 0600))
+
+	tt := []struct {
+		name        string
+		key         string
+		value       string
+		expected    config.ServerConfig
+		expectedErr string
+	}{
+		{
+			name:     "proxy url",
+			key:      "server1.proxyUrl",
+			value:    "http://proxy.example.com:3128",
+			expected: config.ServerConfig{URL: "https://myserver-1.com", ProxyURL: "http://proxy.example.com:3128"},
+		},
+		{
+			name:        "invalid proxy url",
+			key:         "server1.proxyUrl",
+			value:       "proxy.example.com",
+			expectedErr: `invalid proxy URL "proxy.example.com", must be a URL such as http://proxy.example.com:3128`,
+		},
+		{
+			name:        "invalid url",
+			key:         "server1.url",
+			value:       "ftp://rancher.example.com",
+			expectedErr: `invalid url "ftp://rancher.example.com", must be an http(s) URL (e.g. https://rancher.yourdomain.com)`,
+		},
+		{
+			name:     "http timeout",
+			key:      "server1.httpTimeoutSeconds",
+			value:    "30",
+			expected: config.ServerConfig{URL: "https://myserver-1.com", HTTPTimeoutSeconds: 30},
+		},
+		{
+			name:        "invalid http timeout",
+			key:         "server1.httpTimeoutSeconds",
+			value:       "-1",
+			expectedErr: `invalid httpTimeoutSeconds "-1", must be a positive number of seconds`,
+		},
+		{
+			name:     "cacert from a file",
+			key:      "server1.cacert",
+			value:    caPath,
+			expected: config.ServerConfig{URL: "https://myserver-1.com", CACerts: caCert},
+		},
+		{
+			name:     "cacert content",
+			key:      "server1.cacert",
+			value:    caCert,
+			expected: config.ServerConfig{URL: "https://myserver-1.com", CACerts: caCert},
+		},
+		{
+			name:        "invalid cacert",
+			key:         "server1.cacert",
+			value:       "-----BEGIN CERTIFICATE-----",
+			expectedErr: "invalid cacert: no cert was found",
+		},
+		{
+			name:     "url drops the path",
+			key:      "server1.url",
+			value:    "https://rancher.example.com/v3",
+			expected: config.ServerConfig{URL: "https://rancher.example.com"},
+		},
+		{
+			name:        "url can't be unset",
+			key:         "server1.url",
+			expectedErr: "url can't be unset, use 'rancher server delete' to remove the server",
+		},
+		{
+			name:        "invalid project",
+			key:         "server1.project",
+			value:       "p-12345",
+			expectedErr: `invalid project "p-12345", must be in the <cluster-id>:<project-id> format`,
+		},
+		{
+			name:        "unknown field",
+			key:         "server1.secretKey",
+			value:       "secret",
+			expectedErr: `unknown field "secretKey", must be one of: cacert, httpTimeoutSeconds, project, proxyUrl, url`,
+		},
+		{
+			name:        "unknown server",
+			key:         "notfound-server.proxyUrl",
+			value:       "http://proxy.example.com:3128",
+			expectedErr: "server notfound-server is not configured",
+		},
+		{
+			name:        "missing field",
+			key:         "server1",
+			expectedErr: `invalid key "server1", must be in the <server>.<field> format`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := newTestConfig()
+			err := setServerConfigField(cfg, tc.key, tc.value)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, *cfg.Servers["server1"])
+		})
+	}
+}
+
+func TestUnsetServerConfigField(t *testing.T) {
+	t.Parallel()
+
+	cfg := newTestConfig()
+	cfg.Servers["server.example.com"] = &config.ServerConfig{
+		URL:      "https://server.example.com",
+		ProxyURL: "http://proxy.example.com:3128",
+	}
+
+	require.NoError(t, setServerConfigField(cfg, "server.example.com.proxyUrl", ""))
+	assert.Empty(t, cfg.Servers["server.example.com"].ProxyURL)
+}
+
+func newTestCACert(t *testing.T) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dynamiclistener-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
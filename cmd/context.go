@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/rancher/cli/cliclient"
+	"github.com/rancher/cli/config"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v3"
 )
@@ -40,6 +41,9 @@ func contextSwitch(ctx context.Context, cmd *cli.Command) error {
 	if err != nil {
 		return err
 	}
+	if cf.FromEnvironment() {
+		return config.ErrEnvironmentConfig
+	}
 
 	server, err := cf.GetCurrentServer()
 	if err != nil {
@@ -73,12 +77,12 @@ func contextSwitch(ctx context.Context, cmd *cli.Command) error {
 
 	logrus.Infof("Setting new context to project %s", project.Name)
 
-	server.Project = project.ID
-
-	err = cf.Write()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return updateConfig(cmd, func(cf *config.Config) error {
+		server, err := cf.GetCurrentServer()
+		if err != nil {
+			return err
+		}
+		server.Project = project.ID
+		return nil
+	})
 }
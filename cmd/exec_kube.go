@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/urfave/cli/v3"
+)
+
+const execKubeDescription = `
+Runs a command with KUBECONFIG set to the kubeconfig of the current cluster, so
+that any Kubernetes tool can be used with it.
+
+Example:
+	$ rancher exec-kube -- helm list -A
+	$ rancher exec-kube -- k9s
+`
+
+func ExecKubeCommand() *cli.Command {
+	return &cli.Command{
+		Name:            "exec-kube",
+		Usage:           "Run a command with the kubeconfig of the current cluster",
+		Description:     execKubeDescription,
+		ArgsUsage:       "-- COMMAND [ARGS...]",
+		Action:          execKube,
+		SkipFlagParsing: true,
+	}
+}
+
+func ShellCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "shell",
+		Usage: "Open a shell with the kubeconfig of the current cluster",
+		Description: "Opens $SHELL with KUBECONFIG set to the kubeconfig of the current cluster, the kubeconfig is " +
+			"removed when the shell exits",
+		Action: shell,
+	}
+}
+
+func execKube(ctx context.Context, cmd *cli.Command) error {
+	args := cmd.Args().Slice()
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	} else if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cli.ShowCommandHelp(ctx, cmd, "exec-kube")
+	}
+	if len(args) == 0 {
+		return cli.ShowCommandHelp(ctx, cmd, "exec-kube")
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return fmt.Errorf("%s is required to be set in your path: %w", args[0], err)
+	}
+
+	kubeConfig, err := currentClusterKubeConfig(ctx, cmd, false, false)
+	if err != nil {
+		return err
+	}
+	return processExitCode(runWithKubeConfig(runtimeDir(cmd), kubeConfig, false, path, args[1:]))
+}
+
+func shell(ctx context.Context, cmd *cli.Command) error {
+	path, err := exec.LookPath(userShell())
+	if err != nil {
+		return fmt.Errorf("unable to find the shell to open: %w", err)
+	}
+
+	kubeConfig, err := currentClusterKubeConfig(ctx, cmd, false, false)
+	if err != nil {
+		return err
+	}
+
+	customPrint(fmt.Sprintf("Opening %s with the kubeconfig of context [%s], exit the shell to return", path, kubeConfig.CurrentContext))
+	return processExitCode(runWithKubeConfig(runtimeDir(cmd), kubeConfig, false, path, nil))
+}
+
+// userShell returns the shell of the user, from $SHELL or %COMSPEC% on
+// Windows.
+func userShell() string {
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+		return "cmd.exe"
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
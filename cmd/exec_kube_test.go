@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestRunWithKubeConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	t.Parallel()
+
+	kubeConfig := api.NewConfig()
+	kubeConfig.CurrentContext = "downstream"
+	secretsDir := filepath.Join(t.TempDir(), "runtime")
+
+	// the kubeconfig is readable by the command, and the exit code is kept
+	// for processExitCode
+	pathFile := filepath.Join(t.TempDir(), "path")
+	script := `grep -q "current-context: downstream" "$KUBECONFIG" && printf %s "$KUBECONFIG" > "$0" && exit 3`
+	err := runWithKubeConfig(secretsDir, kubeConfig, false, "sh", []string{"-c", script, pathFile})
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), "unexpected error %v", err)
+	assert.Equal(t, 3, exitErr.ExitCode())
+
+	// the kubeconfig was in the secrets directory, only accessible by the
+	// user, and is removed once the command exits
+	path, err := os.ReadFile(pathFile)
+	require.NoError(t, err)
+	assert.Equal(t, secretsDir, filepath.Dir(string(path)))
+	_, err = os.Stat(string(path))
+	assert.True(t, os.IsNotExist(err))
+	info, err := os.Stat(secretsDir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+}
+
+func TestRunWithInheritedKubeConfig(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses /dev/fd")
+	}
+	t.Parallel()
+
+	kubeConfig := api.NewConfig()
+	kubeConfig.CurrentContext = "downstream"
+	secretsDir := t.TempDir()
+
+	// the kubeconfig can be read more than once, with no file in the
+	// secrets directory
+	script := `grep -q "current-context: downstream" "$KUBECONFIG" && grep -q "current-context: downstream" "$KUBECONFIG" && ` +
+		`[ "$KUBECONFIG" = /dev/fd/3 ] && [ -z "$(ls -A "$0")" ]`
+	err := runWithKubeConfig(secretsDir, kubeConfig, true, "sh", []string{"-c", script, secretsDir})
+	assert.NoError(t, err)
+}
+
+func TestUserShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses COMSPEC")
+	}
+
+	t.Setenv("SHELL", "/bin/zsh")
+	assert.Equal(t, "/bin/zsh", userShell())
+
+	t.Setenv("SHELL", "")
+	assert.Equal(t, "/bin/sh", userShell())
+}
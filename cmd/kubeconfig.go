@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/cli/config"
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const kubeconfigMergeDescription = `
+Merges Rancher clusters into a kubeconfig file, $KUBECONFIG or ~/.kube/config by
+default, so that kubectl, helm or k9s can be used without the rancher CLI. The
+users of the merged contexts run 'rancher token' to get their credentials, no
+token is written to the kubeconfig file. They use the config directory given
+with --config or RANCHER_CONFIG_DIR, if any.
+
+The contexts, clusters and users are named after the clusters. Entries with the
+same names are replaced when they belong to the same Rancher server, use
+--prefix to merge the clusters of another server next to them, or --overwrite
+to replace them.
+
+Example:
+	# Merge every cluster of the current server
+	$ rancher kubeconfig merge --all
+
+	# Merge two clusters, by name or ID, into another file
+	$ rancher kubeconfig merge --kubeconfig ~/.kube/rancher downstream c-abcde
+
+	# Merge the clusters of a second server
+	$ rancher --server staging kubeconfig merge --all --prefix staging-
+`
+
+// kubeconfigCluster is a Rancher cluster merged into a kubeconfig file.
+type kubeconfigCluster struct {
+	// Name is the name of the kubeconfig cluster, user and context.
+	Name string
+	ID   string
+}
+
+func KubeconfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "kubeconfig",
+		Usage: "Operations on local kubeconfig files",
+		Commands: []*cli.Command{
+			{
+				Name:        "merge",
+				Usage:       "Merge Rancher clusters into a kubeconfig file",
+				Description: kubeconfigMergeDescription,
+				ArgsUsage:   "[CLUSTERID/CLUSTERNAME...]",
+				Action:      kubeconfigMerge,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Merge all the clusters of the current server",
+					},
+					&cli.StringFlag{
+						Name:  "kubeconfig",
+						Usage: "Kubeconfig file to merge the clusters into, $KUBECONFIG or ~/.kube/config by default",
+					},
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "Prefix of the names of the merged contexts, clusters and users",
+					},
+					&cli.BoolFlag{
+						Name:  "overwrite",
+						Usage: "Replace the entries with the same names that don't belong to the current server",
+					},
+				},
+			},
+		},
+	}
+}
+
+func kubeconfigMerge(ctx context.Context, cmd *cli.Command) error {
+	if cmd.NArg() == 0 && !cmd.Bool("all") {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+	if cmd.NArg() > 0 && cmd.Bool("all") {
+		return errors.New("clusters can't be given with --all")
+	}
+
+	c, err := GetClient(cmd)
+	if err != nil {
+		return err
+	}
+	tokenAPI, err := newServerTokenAPI(cmd)
+	if err != nil {
+		return err
+	}
+	extGetter := func(ctx context.Context, id string) (*extv1.Token, error) {
+		return getExtToken(ctx, id, tokenAPI.baseURL, tokenAPI.bearerToken, tokenAPI.client)
+	}
+	userID, err := getTokenUserID(ctx, tokenAPI.serverConfig.AccessKey, c.ManagementClient.Token.ByID, extGetter)
+	if err != nil {
+		return err
+	}
+
+	var clusters []kubeconfigCluster
+	if cmd.Bool("all") {
+		collection, err := c.ManagementClient.Cluster.List(baseListOpts())
+		if err != nil {
+			return err
+		}
+		for _, cluster := range collection.Data {
+			clusters = append(clusters, kubeconfigCluster{Name: getClusterName(&cluster), ID: cluster.ID})
+		}
+	} else {
+		for _, name := range cmd.Args().Slice() {
+			resource, err := Lookup(c, name, "cluster")
+			if err != nil {
+				return err
+			}
+			cluster, err := getClusterByID(c, resource.ID)
+			if err != nil {
+				return err
+			}
+			clusters = append(clusters, kubeconfigCluster{Name: getClusterName(cluster), ID: cluster.ID})
+		}
+	}
+	if len(clusters) == 0 {
+		return errors.New("no clusters to merge")
+	}
+	for i := range clusters {
+		clusters[i].Name = cmd.String("prefix") + clusters[i].Name
+	}
+
+	pathOptions := kubeconfigPathOptions(cmd.String("kubeconfig"))
+	kubeConfig, err := pathOptions.GetStartingConfig()
+	if err != nil {
+		return fmt.Errorf("error loading the kubeconfig: %w", err)
+	}
+
+	err = mergeKubeconfigClusters(kubeConfig, tokenAPI.serverConfig, userID, rancherExecutable(), customConfigDir(cmd), clusters, cmd.Bool("overwrite"))
+	if err != nil {
+		return err
+	}
+
+	// the entries are written to the files they were loaded from, like kubectl
+	// config does, and the new ones to the default file
+	if err := clientcmd.ModifyConfig(pathOptions, *kubeConfig, false); err != nil {
+		return fmt.Errorf("error writing the kubeconfig: %w", err)
+	}
+	for _, cluster := range clusters {
+		customPrint(fmt.Sprintf("merged context [%s] for cluster [%s]", cluster.Name, cluster.ID))
+	}
+	return nil
+}
+
+// kubeconfigPathOptions returns the kubeconfig files to merge into: path if
+// it's not empty, or else the files of $KUBECONFIG, or ~/.kube/config.
+func kubeconfigPathOptions(path string) *clientcmd.PathOptions {
+	pathOptions := clientcmd.NewDefaultPathOptions()
+	pathOptions.LoadingRules.ExplicitPath = path
+	return pathOptions
+}
+
+// rancherExecutable returns the command kubectl runs to get the credentials
+// of the merged users: rancher if it's in the PATH, so that the kubeconfig
+// keeps working after an upgrade installing a new versioned path, or else the
+// current executable.
+func rancherExecutable() string {
+	if _, err := exec.LookPath("rancher"); err == nil {
+		return "rancher"
+	}
+	path, err := os.Executable()
+	if err != nil {
+		logrus.Debugf("Unable to resolve the rancher executable: %s", err)
+		return "rancher"
+	}
+	return path
+}
+
+// customConfigDir returns the absolute path of the config directory given with
+// --config or RANCHER_CONFIG_DIR, or an empty string for the default one.
+func customConfigDir(cmd *cli.Command) string {
+	dir, err := filepath.Abs(cmd.String("config"))
+	if err != nil {
+		logrus.Debugf("Unable to resolve the config directory: %s", err)
+		return ""
+	}
+	if defaultDir, err := ConfigDir(); err == nil && dir == filepath.Clean(defaultDir) {
+		return ""
+	}
+	return dir
+}
+
+// mergeKubeconfigClusters adds a cluster, a user and a context for each of the
+// clusters to kubeConfig, replacing the entries with the same names. The
+// clusters are reached through the Rancher proxy and the users run 'rancher
+// token' to authenticate. The current context is only set if there's none.
+// Entries that don't belong to the server are only replaced with overwrite.
+// The users read the config from configDir, unless it's empty.
+func mergeKubeconfigClusters(kubeConfig *api.Config, serverConfig *config.ServerConfig, userID, command, configDir string, clusters []kubeconfigCluster, overwrite bool) error {
+	proxyURL := serverConfig.URL + "/k8s/clusters/"
+	if !overwrite {
+		for _, cluster := range clusters {
+			if !serverKubeconfigEntries(kubeConfig, cluster.Name, proxyURL) {
+				return fmt.Errorf("the kubeconfig entries named %s don't belong to %s, use --prefix to merge the cluster under another name or --overwrite to replace them", cluster.Name, serverConfig.URL)
+			}
+		}
+	}
+
+	for _, cluster := range clusters {
+		kubeCluster := api.NewCluster()
+		kubeCluster.Server = proxyURL + cluster.ID
+		if serverConfig.CACerts != "" {
+			kubeCluster.CertificateAuthorityData = []byte(serverConfig.CACerts)
+		}
+		// replaced entries are written back to the file they come from
+		if existing := kubeConfig.Clusters[cluster.Name]; existing != nil {
+			kubeCluster.LocationOfOrigin = existing.LocationOfOrigin
+		}
+		kubeConfig.Clusters[cluster.Name] = kubeCluster
+
+		args := []string{
+			"token",
+			"--server", serverConfig.URL,
+			"--user", userID,
+			"--cluster", cluster.ID,
+		}
+		if configDir != "" {
+			args = append(args, "--config", configDir)
+		}
+		authInfo := api.NewAuthInfo()
+		authInfo.Exec = &api.ExecConfig{
+			APIVersion:      execCredentialV1Beta1,
+			Command:         command,
+			Args:            args,
+			InteractiveMode: api.IfAvailableExecInteractiveMode,
+		}
+		if existing := kubeConfig.AuthInfos[cluster.Name]; existing != nil {
+			authInfo.LocationOfOrigin = existing.LocationOfOrigin
+		}
+		kubeConfig.AuthInfos[cluster.Name] = authInfo
+
+		kubeContext := api.NewContext()
+		kubeContext.Cluster = cluster.Name
+		kubeContext.AuthInfo = cluster.Name
+		if existing := kubeConfig.Contexts[cluster.Name]; existing != nil {
+			kubeContext.LocationOfOrigin = existing.LocationOfOrigin
+		}
+		kubeConfig.Contexts[cluster.Name] = kubeContext
+	}
+
+	if kubeConfig.CurrentContext == "" && len(clusters) > 0 {
+		kubeConfig.CurrentContext = clusters[0].Name
+	}
+	return nil
+}
+
+// serverKubeconfigEntries reports whether the entries named name, if any, are
+// those of a cluster reached through proxyURL, as merged by
+// mergeKubeconfigClusters.
+func serverKubeconfigEntries(kubeConfig *api.Config, name, proxyURL string) bool {
+	if kubeContext := kubeConfig.Contexts[name]; kubeContext != nil && kubeContext.Cluster != name {
+		return false
+	}
+	if kubeCluster := kubeConfig.Clusters[name]; kubeCluster != nil && !strings.HasPrefix(kubeCluster.Server, proxyURL) {
+		return false
+	}
+	return true
+}
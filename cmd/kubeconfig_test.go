@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestMergeKubeconfigClusters(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config")
+	pathOptions := kubeconfigPathOptions(path)
+	kubeConfig, err := pathOptions.GetStartingConfig()
+	require.NoError(t, err)
+
+	// an unrelated context and a stale Rancher one are kept and replaced
+	kubeConfig.Clusters["kind"] = &api.Cluster{Server: "https://127.0.0.1:6443"}
+	kubeConfig.Contexts["kind"] = &api.Context{Cluster: "kind"}
+	kubeConfig.AuthInfos["downstream"] = &api.AuthInfo{Token: "kubeconfig-u-abcde:secret"}
+	kubeConfig.CurrentContext = "kind"
+
+	serverConfig := &config.ServerConfig{URL: "https://rancher.example.com", CACerts: "-----BEGIN CERTIFICATE-----"}
+	clusters := []kubeconfigCluster{
+		{Name: "local", ID: "local"},
+		{Name: "downstream", ID: "c-12345"},
+	}
+	require.NoError(t, mergeKubeconfigClusters(kubeConfig, serverConfig, "u-abcde", "/usr/local/bin/rancher", "", clusters, false))
+	require.NoError(t, clientcmd.ModifyConfig(pathOptions, *kubeConfig, false))
+
+	merged, err := clientcmd.LoadFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "kind", merged.CurrentContext)
+	assert.Contains(t, merged.Contexts, "kind")
+
+	require.Contains(t, merged.Clusters, "downstream")
+	assert.Equal(t, "https://rancher.example.com/k8s/clusters/c-12345", merged.Clusters["downstream"].Server)
+	assert.Equal(t, []byte("-----BEGIN CERTIFICATE-----"), merged.Clusters["downstream"].CertificateAuthorityData)
+
+	require.Contains(t, merged.AuthInfos, "downstream")
+	authInfo := merged.AuthInfos["downstream"]
+	assert.Empty(t, authInfo.Token)
+	require.NotNil(t, authInfo.Exec)
+	assert.Equal(t, "client.authentication.k8s.io/v1beta1", authInfo.Exec.APIVersion)
+	assert.Equal(t, "/usr/local/bin/rancher", authInfo.Exec.Command)
+	assert.Equal(t, []string{"token", "--server", "https://rancher.example.com", "--user", "u-abcde", "--cluster", "c-12345"}, authInfo.Exec.Args)
+
+	require.Contains(t, merged.Contexts, "local")
+	assert.Equal(t, "local", merged.Contexts["local"].Cluster)
+	assert.Equal(t, "local", merged.Contexts["local"].AuthInfo)
+}
+
+func TestMergeKubeconfigClustersSetsCurrentContext(t *testing.T) {
+	t.Parallel()
+
+	kubeConfig := api.NewConfig()
+	serverConfig := &config.ServerConfig{URL: "https://rancher.example.com"}
+	require.NoError(t, mergeKubeconfigClusters(kubeConfig, serverConfig, "u-abcde", "rancher", "", []kubeconfigCluster{{Name: "prod-local", ID: "local"}}, false))
+
+	assert.Equal(t, "prod-local", kubeConfig.CurrentContext)
+	assert.Empty(t, kubeConfig.Clusters["prod-local"].CertificateAuthorityData)
+}
+
+func TestMergeKubeconfigClustersConfigDir(t *testing.T) {
+	t.Parallel()
+
+	kubeConfig := api.NewConfig()
+	serverConfig := &config.ServerConfig{URL: "https://rancher.example.com"}
+	require.NoError(t, mergeKubeconfigClusters(kubeConfig, serverConfig, "u-abcde", "rancher", "/srv/rancher", []kubeconfigCluster{{Name: "local", ID: "local"}}, false))
+
+	assert.Equal(t, []string{"token", "--server", "https://rancher.example.com", "--user", "u-abcde", "--cluster", "local", "--config", "/srv/rancher"}, kubeConfig.AuthInfos["local"].Exec.Args)
+}
+
+func TestMergeKubeconfigClustersOfAnotherServer(t *testing.T) {
+	t.Parallel()
+
+	kubeConfig := api.NewConfig()
+	staging := &config.ServerConfig{URL: "https://staging.example.com"}
+	require.NoError(t, mergeKubeconfigClusters(kubeConfig, staging, "u-abcde", "rancher", "", []kubeconfigCluster{{Name: "local", ID: "local"}}, false))
+	kubeConfig.Contexts["kind"] = &api.Context{Cluster: "kind-kind"}
+
+	// the entries of another server, or of another tool, are kept
+	serverConfig := &config.ServerConfig{URL: "https://rancher.example.com"}
+	for _, name := range []string{"local", "kind"} {
+		err := mergeKubeconfigClusters(kubeConfig, serverConfig, "u-abcde", "rancher", "", []kubeconfigCluster{{Name: name, ID: "local"}}, false)
+		assert.ErrorContains(t, err, "the kubeconfig entries named "+name+" don't belong to https://rancher.example.com")
+	}
+	assert.Equal(t, "https://staging.example.com/k8s/clusters/local", kubeConfig.Clusters["local"].Server)
+
+	require.NoError(t, mergeKubeconfigClusters(kubeConfig, serverConfig, "u-abcde", "rancher", "", []kubeconfigCluster{{Name: "local", ID: "local"}}, true))
+	assert.Equal(t, "https://rancher.example.com/k8s/clusters/local", kubeConfig.Clusters["local"].Server)
+}
+
+func TestKubeconfigPathOptions(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	kind := api.NewConfig()
+	kind.Clusters["kind"] = &api.Cluster{Server: "https://127.0.0.1:6443"}
+	require.NoError(t, clientcmd.WriteToFile(*kind, first))
+	stale := api.NewConfig()
+	stale.Clusters["downstream"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-67890"}
+	require.NoError(t, clientcmd.WriteToFile(*stale, second))
+	t.Setenv("KUBECONFIG", first+string(filepath.ListSeparator)+second)
+
+	pathOptions := kubeconfigPathOptions("")
+	kubeConfig, err := pathOptions.GetStartingConfig()
+	require.NoError(t, err)
+	serverConfig := &config.ServerConfig{URL: "https://rancher.example.com"}
+	clusters := []kubeconfigCluster{{Name: "downstream", ID: "c-12345"}}
+	require.NoError(t, mergeKubeconfigClusters(kubeConfig, serverConfig, "u-abcde", "rancher", "", clusters, false))
+	require.NoError(t, clientcmd.ModifyConfig(pathOptions, *kubeConfig, false))
+
+	// the stale cluster is replaced in its file, the new entries are written
+	// to the first file
+	updated, err := clientcmd.LoadFromFile(second)
+	require.NoError(t, err)
+	assert.Equal(t, "https://rancher.example.com/k8s/clusters/c-12345", updated.Clusters["downstream"].Server)
+	assert.NotContains(t, updated.Contexts, "downstream")
+
+	updated, err = clientcmd.LoadFromFile(first)
+	require.NoError(t, err)
+	assert.Contains(t, updated.Clusters, "kind")
+	assert.Contains(t, updated.Contexts, "downstream")
+	assert.Equal(t, "downstream", updated.CurrentContext)
+}
+
+func TestCustomConfigDir(t *testing.T) {
+	t.Parallel()
+
+	defaultDir, err := ConfigDir()
+	require.NoError(t, err)
+	customDir := t.TempDir()
+
+	for dir, expected := range map[string]string{
+		defaultDir:       "",
+		defaultDir + "/": "",
+		customDir:        customDir,
+	} {
+		var actual string
+		root := &cli.Command{
+			Name:  "rancher",
+			Flags: []cli.Flag{&cli.StringFlag{Name: "config"}},
+			Action: func(_ context.Context, cmd *cli.Command) error {
+				actual = customConfigDir(cmd)
+				return nil
+			},
+		}
+		require.NoError(t, root.Run(t.Context(), []string{"rancher", "--config", dir}))
+		assert.Equal(t, expected, actual, "config %s", dir)
+	}
+}
@@ -1,23 +1,113 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/rancher/cli/cliclient"
+	"github.com/rancher/cli/config"
+	"github.com/rancher/norman/types"
 	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v3"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
+const kubectlDescription = `
+Use the current cluster context to run kubectl commands in the cluster.
+
+The following options select other clusters without changing the current
+context. They must be given before the kubectl arguments:
+
+	--cluster CLUSTER       Cluster ID, name or glob, matching several clusters
+	                        runs the command on each of them
+	--clusters A,B,C        Run the command on each of the clusters, by ID, name
+	                        or glob
+	--all-clusters          Run the command on every cluster
+	--parallel N            Number of clusters the command runs on at once,
+	                        4 by default
+	--revalidate            Validate the token of the cached kubeconfig
+	                        against the server
+	--endpoint ENDPOINT     Endpoint reaching the clusters: 'rancher' for the
+	                        Rancher proxy, 'ace' for the authorized cluster
+	                        endpoint, or 'auto' for a reachable authorized
+	                        cluster endpoint, falling back to the Rancher
+	                        proxy. The current context of the kubeconfig is
+	                        used by default. With 'ace' or 'auto', the cached
+	                        kubeconfigs are used when the Rancher server is
+	                        unavailable
+
+When the command runs on several clusters, each output line is prefixed with
+the name of the cluster, and the command fails if it failed on any cluster.
+
+The kubeconfigs are cached with the expiry of their token, which is only
+validated against the server when near its expiry.
+
+Example:
+	$ rancher kubectl --cluster downstream get nodes
+	$ rancher kubectl --clusters 'prod-*,staging' get pods -A
+	$ rancher kubectl --endpoint auto get nodes
+`
+
+// defaultKubectlParallel is the number of clusters kubectl runs on at once.
+const defaultKubectlParallel = 4
+
+const (
+	// kubeConfigExpiryMargin is how long before the expiry of its token a
+	// cached kubeconfig is validated against the server again.
+	kubeConfigExpiryMargin = 5 * time.Minute
+	// kubeConfigRevalidateInterval is how often a cached kubeconfig whose
+	// token doesn't expire is validated against the server.
+	kubeConfigRevalidateInterval = time.Hour
+)
+
+// kubectlOptions are the options of 'rancher kubectl', parsed by hand from the
+// arguments as flag parsing is skipped for kubectl.
+type kubectlOptions struct {
+	selectors   []string
+	allClusters bool
+	parallel    int
+	// fanOut is set when the command runs on several clusters, with output
+	// lines prefixed with the cluster names.
+	fanOut     bool
+	revalidate bool
+	endpoint   string
+	args       []string
+}
+
+// kubeConfigResolver returns the kubeconfigs of the clusters of the current
+// server for its user. The cached kubeconfigs are reused while their token is
+// valid, new ones are generated otherwise.
+type kubeConfigResolver struct {
+	cmd       *cli.Command
+	client    *cliclient.MasterClient
+	user      string
+	v3ByID    tokenByIDFunc
+	extGetter extTokenGetterFunc
+	// revalidate validates the tokens of the cached kubeconfigs against the
+	// server, even when they're far from their expiry.
+	revalidate bool
+}
+
 func KubectlCommand() *cli.Command {
 	return &cli.Command{
 		Name:            "kubectl",
 		Usage:           "Run kubectl commands",
-		Description:     "Use the current cluster context to run kubectl commands in the cluster",
+		Description:     kubectlDescription,
 		Action:          runKubectl,
 		SkipFlagParsing: true,
 	}
@@ -29,6 +119,11 @@ func runKubectl(ctx context.Context, cmd *cli.Command) error {
 		return cli.ShowCommandHelp(ctx, cmd, "kubectl")
 	}
 
+	opts, err := parseKubectlArgs(args)
+	if err != nil {
+		return err
+	}
+
 	path, err := exec.LookPath("kubectl")
 	if err != nil {
 		return fmt.Errorf("kubectl is required to be set in your path to use this "+
@@ -36,111 +131,612 @@ func runKubectl(ctx context.Context, cmd *cli.Command) error {
 			"for more info. Error: %s", err.Error())
 	}
 
-	c, err := GetClient(cmd)
+	if !opts.allClusters && len(opts.selectors) == 0 {
+		kubeConfig, err := currentClusterKubeConfig(ctx, cmd, opts.revalidate, opts.direct())
+		if err != nil {
+			return err
+		}
+		if kubeConfig, err = selectCachedKubeEndpoint(ctx, cmd, kubeConfig, opts.endpoint); err != nil {
+			return err
+		}
+		return runWithKubeConfig(runtimeDir(cmd), kubeConfig, true, path, opts.args)
+	}
+
+	clusters, kubeConfigFor, err := kubectlClusters(ctx, cmd, opts)
 	if err != nil {
 		return err
 	}
+	if opts.fanOut || len(clusters) > 1 {
+		run := func(ctx context.Context, cluster kubeconfigCluster, stdout, stderr io.Writer) error {
+			kubeConfig, err := kubeConfigFor(ctx, cluster.ID)
+			if err != nil {
+				return err
+			}
+			if kubeConfig, err = selectCachedKubeEndpoint(ctx, cmd, kubeConfig, opts.endpoint); err != nil {
+				return err
+			}
+			return execWithKubeConfig(runtimeDir(cmd), kubeConfig, true, path, opts.args, nil, stdout, stderr)
+		}
+		return runOnClusters(ctx, clusters, opts.parallel, os.Stdout, os.Stderr, run)
+	}
 
-	config, err := loadConfig(cmd)
+	kubeConfig, err := kubeConfigFor(ctx, clusters[0].ID)
 	if err != nil {
 		return err
 	}
+	if kubeConfig, err = selectCachedKubeEndpoint(ctx, cmd, kubeConfig, opts.endpoint); err != nil {
+		return err
+	}
+	return runWithKubeConfig(runtimeDir(cmd), kubeConfig, true, path, opts.args)
+}
 
-	currentRancherServer, err := config.GetCurrentServer()
+// direct reports whether the endpoint option may reach the clusters without
+// the Rancher server, through their Authorized Cluster Endpoint.
+func (o kubectlOptions) direct() bool {
+	return o.endpoint == endpointACE || o.endpoint == endpointAuto
+}
+
+// kubectlClusters returns the clusters selected by opts and the function
+// returning their kubeconfigs. When the Rancher server can't be reached and
+// the clusters may be reached directly, the clusters are selected among those
+// whose kubeconfig is cached, by the cluster names of the kubeconfigs.
+func kubectlClusters(ctx context.Context, cmd *cli.Command, opts kubectlOptions) ([]kubeconfigCluster, func(context.Context, string) (*api.Config, error), error) {
+	resolver, err := newKubeConfigResolver(ctx, cmd, opts.revalidate)
+	if err == nil {
+		var collection *managementClient.ClusterCollection
+		if collection, err = resolver.client.ManagementClient.Cluster.List(baseListOpts()); err == nil {
+			clusters, err := selectClusters(collection.Data, opts.selectors, opts.allClusters)
+			return clusters, resolver.kubeConfig, err
+		}
+	}
+	if !opts.direct() {
+		return nil, nil, err
+	}
+
+	cf, cfErr := loadConfig(cmd)
+	if cfErr != nil {
+		return nil, nil, err
+	}
+	serverConfig, cfErr := cf.GetCurrentServer()
+	if cfErr != nil {
+		return nil, nil, err
+	}
+	var (
+		cached      []managementClient.Cluster
+		kubeConfigs = make(map[string]*api.Config)
+	)
+	for _, c := range cachedKubeConfigs(serverConfig) {
+		cached = append(cached, managementClient.Cluster{Resource: types.Resource{ID: c.ID}, Name: c.Name})
+		kubeConfigs[c.ID] = c.KubeConfig
+	}
+	clusters, selectErr := selectClusters(cached, opts.selectors, opts.allClusters)
+	if selectErr != nil {
+		return nil, nil, err
+	}
+
+	logrus.Warnf("Using the cached kubeconfigs, the Rancher server is unavailable: %s", err)
+	return clusters, func(_ context.Context, clusterID string) (*api.Config, error) {
+		return kubeConfigs[clusterID], nil
+	}, nil
+}
+
+// parseKubectlArgs parses the options given before the kubectl arguments.
+func parseKubectlArgs(args []string) (kubectlOptions, error) {
+	opts := kubectlOptions{parallel: defaultKubectlParallel}
+
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		// value returns the value of the option, from the next argument
+		// unless it's given as --name=value.
+		next := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if len(args) < 2 || args[1] == "" {
+				return "", fmt.Errorf("%s requires a value", name)
+			}
+			args = args[1:]
+			return args[0], nil
+		}
+
+		switch name {
+		case "--cluster":
+			selector, err := next()
+			if err != nil {
+				return opts, err
+			}
+			opts.selectors = append(opts.selectors, selector)
+		case "--clusters":
+			selectors, err := next()
+			if err != nil {
+				return opts, err
+			}
+			for _, selector := range strings.Split(selectors, ",") {
+				if selector = strings.TrimSpace(selector); selector != "" {
+					opts.selectors = append(opts.selectors, selector)
+				}
+			}
+			opts.fanOut = true
+		case "--all-clusters":
+			if hasValue {
+				return opts, fmt.Errorf("%s doesn't take a value", name)
+			}
+			opts.allClusters = true
+			opts.fanOut = true
+		case "--endpoint":
+			endpoint, err := next()
+			if err != nil {
+				return opts, err
+			}
+			if err := validateKubeEndpoint(endpoint); err != nil {
+				return opts, err
+			}
+			opts.endpoint = endpoint
+		case "--revalidate":
+			if hasValue {
+				return opts, fmt.Errorf("%s doesn't take a value", name)
+			}
+			opts.revalidate = true
+		case "--parallel":
+			parallel, err := next()
+			if err != nil {
+				return opts, err
+			}
+			if opts.parallel, err = strconv.Atoi(parallel); err != nil || opts.parallel < 1 {
+				return opts, fmt.Errorf("invalid --parallel %q, must be a positive number", parallel)
+			}
+		default:
+			opts.args = args
+			return opts, nil
+		}
+		args = args[1:]
+	}
+
+	return opts, nil
+}
+
+// selectClusters returns the clusters matching the selectors, by ID, name or
+// glob, or all the clusters. Every selector must match a cluster.
+func selectClusters(clusters []managementClient.Cluster, selectors []string, all bool) ([]kubeconfigCluster, error) {
+	var (
+		selected []kubeconfigCluster
+		seen     = make(map[string]bool)
+	)
+	add := func(cluster *managementClient.Cluster) {
+		if !seen[cluster.ID] {
+			seen[cluster.ID] = true
+			selected = append(selected, kubeconfigCluster{Name: getClusterName(cluster), ID: cluster.ID})
+		}
+	}
+
+	if all {
+		for i := range clusters {
+			add(&clusters[i])
+		}
+	}
+
+	for _, selector := range selectors {
+		var matched bool
+		for i := range clusters {
+			cluster := &clusters[i]
+			ok := cluster.ID == selector || getClusterName(cluster) == selector
+			if !ok {
+				byName, err := path.Match(selector, getClusterName(cluster))
+				if err != nil {
+					return nil, fmt.Errorf("invalid cluster selector %q: %w", selector, err)
+				}
+				byID, _ := path.Match(selector, cluster.ID)
+				ok = byName || byID
+			}
+			if ok {
+				matched = true
+				add(cluster)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no cluster matches %q, run `rancher clusters` to see available clusters", selector)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, errors.New("no clusters found")
+	}
+	return selected, nil
+}
+
+// runOnClusters calls run for each cluster, at most parallel at once, with
+// the output lines of each cluster prefixed with its name. It returns an
+// error exiting with the highest exit code of the failed runs.
+func runOnClusters(ctx context.Context, clusters []kubeconfigCluster, parallel int, stdout, stderr io.Writer, run func(ctx context.Context, cluster kubeconfigCluster, stdout, stderr io.Writer) error) error {
+	width := 0
+	for _, cluster := range clusters {
+		width = max(width, len(cluster.Name))
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, max(parallel, 1))
+		errs = make([]error, len(clusters))
+	)
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prefix := fmt.Sprintf("%-*s | ", width, cluster.Name)
+			out := &prefixWriter{mu: &mu, w: stdout, prefix: prefix}
+			errOut := &prefixWriter{mu: &mu, w: stderr, prefix: prefix}
+			errs[i] = run(ctx, cluster, out, errOut)
+			out.Flush()
+			if errs[i] != nil {
+				var exitErr *exec.ExitError
+				if !errors.As(errs[i], &exitErr) {
+					fmt.Fprintf(errOut, "error: %s\n", errs[i])
+				}
+			}
+			errOut.Flush()
+		}()
+	}
+	wg.Wait()
+
+	var (
+		failed []string
+		code   int
+	)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed = append(failed, clusters[i].Name)
+		exitCode := 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			exitCode = exitErr.ExitCode()
+		}
+		code = max(code, exitCode)
+	}
+	if len(failed) > 0 {
+		return cli.Exit(fmt.Sprintf("failed on %d of %d clusters: %s", len(failed), len(clusters), strings.Join(failed, ", ")), code)
+	}
+	return nil
+}
+
+// prefixWriter prefixes each line written to w. Whole lines are written while
+// holding mu, so that the lines of concurrent writers aren't interleaved.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes the last line, if it doesn't end with a newline.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+	return err
+}
+
+// currentClusterKubeConfig returns the kubeconfig of the current cluster for
+// the user of the current server. Unless revalidate is set, a cached
+// kubeconfig whose token is far from its expiry is returned without reaching
+// the server. With allowStale, the cached kubeconfig is also returned when the
+// server can't be reached, for kubectl to reach the cluster directly.
+func currentClusterKubeConfig(ctx context.Context, cmd *cli.Command, revalidate, allowStale bool) (*api.Config, error) {
+	cf, err := loadConfig(cmd)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	serverConfig, err := cf.GetCurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	cached, token := cachedKubeConfig(serverConfig, serverConfig.GetCurrentCluster())
+	if cached != nil && !revalidate && kubeConfigTokenFresh(token, time.Now()) {
+		return cached, nil
+	}
+
+	resolver, err := newKubeConfigResolver(ctx, cmd, revalidate)
+	if err != nil {
+		if cached != nil && allowStale {
+			logrus.Warnf("Using the cached kubeconfig, the Rancher server is unavailable: %s", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	return resolver.kubeConfig(ctx, resolver.client.UserConfig.GetCurrentCluster())
+}
+
+// cachedClusterKubeConfig is a kubeconfig cached for a cluster of a server.
+type cachedClusterKubeConfig struct {
+	ID string
+	// Name is the name of the cluster, the current context of the
+	// kubeconfigs generated by Rancher.
+	Name       string
+	KubeConfig *api.Config
+	// Token is nil for the kubeconfigs cached by older versions of the CLI.
+	Token *config.KubeConfigToken
+}
+
+// cachedKubeConfigs returns the kubeconfigs cached for the clusters of
+// serverConfig with its access key, one per cluster. The key of the cached
+// kubeconfigs holds the user of the access key, looking them up by access key
+// saves resolving the user. The kubeconfigs cached without a token, by older
+// versions of the CLI, come last, their cluster found in their server.
+func cachedKubeConfigs(serverConfig *config.ServerConfig) []cachedClusterKubeConfig {
+	var (
+		cached []cachedClusterKubeConfig
+		seen   = make(map[string]bool)
+	)
+	add := func(clusterID string, kubeConfig *api.Config, token *config.KubeConfigToken) {
+		if clusterID == "" || kubeConfig == nil || seen[clusterID] {
+			return
+		}
+		seen[clusterID] = true
+		name := kubeConfig.CurrentContext
+		if name == "" {
+			name = clusterID
+		}
+		cached = append(cached, cachedClusterKubeConfig{ID: clusterID, Name: name, KubeConfig: kubeConfig, Token: token})
+	}
+
+	keys := slices.Sorted(maps.Keys(serverConfig.KubeConfigs))
+	for _, key := range keys {
+		if token := serverConfig.KubeConfigTokens[key]; token != nil && token.AccessKey == serverConfig.AccessKey {
+			add(token.ClusterID, serverConfig.KubeConfigs[key], token)
+		}
+	}
+	for _, key := range keys {
+		if serverConfig.KubeConfigTokens[key] == nil {
+			add(kubeConfigClusterID(serverConfig.KubeConfigs[key]), serverConfig.KubeConfigs[key], nil)
+		}
+	}
+	return cached
+}
+
+// cachedKubeConfig returns the kubeconfig cached for the cluster with the
+// access key of serverConfig, and its token, nil for the kubeconfigs cached by
+// older versions of the CLI. The cluster is an ID, or a name as given to
+// --cluster.
+func cachedKubeConfig(serverConfig *config.ServerConfig, cluster string) (*api.Config, *config.KubeConfigToken) {
+	if cluster == "" {
+		return nil, nil
+	}
+	cached := cachedKubeConfigs(serverConfig)
+	if i := slices.IndexFunc(cached, func(c cachedClusterKubeConfig) bool { return c.ID == cluster }); i >= 0 {
+		return cached[i].KubeConfig, cached[i].Token
+	}
+	if i := slices.IndexFunc(cached, func(c cachedClusterKubeConfig) bool { return c.Name == cluster }); i >= 0 {
+		return cached[i].KubeConfig, cached[i].Token
+	}
+	return nil, nil
+}
+
+// selectCachedKubeEndpoint is selectKubeEndpoint, remembering the context
+// selected by endpointAuto in the token of the cached kubeconfig, so that the
+// endpoints aren't probed again until the token is validated again.
+func selectCachedKubeEndpoint(ctx context.Context, cmd *cli.Command, kubeConfig *api.Config, endpoint string) (*api.Config, error) {
+	clusterID := kubeConfigClusterID(kubeConfig)
+	if endpoint != endpointAuto || clusterID == "" {
+		return selectKubeEndpoint(ctx, kubeConfig, endpoint, probeKubeEndpoint)
+	}
+
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	serverConfig, err := cf.GetCurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	_, token := cachedKubeConfig(serverConfig, clusterID)
+	if token != nil && token.Endpoint != "" && kubeConfig.Contexts[token.Endpoint] != nil && kubeConfigTokenFresh(token, time.Now()) {
+		logrus.Debugf("Using the cached endpoint, context %s", token.Endpoint)
+		out := kubeConfig.DeepCopy()
+		out.CurrentContext = token.Endpoint
+		return out, nil
+	}
+
+	selected, err := selectKubeEndpoint(ctx, kubeConfig, endpoint, probeKubeEndpoint)
+	if err != nil || token == nil {
+		return selected, err
+	}
+	err = updateConfig(cmd, func(cf *config.Config) error {
+		serverConfig, err := cf.GetCurrentServer()
+		if err != nil {
+			return err
+		}
+		if _, token := cachedKubeConfig(serverConfig, clusterID); token != nil {
+			token.Endpoint = selected.CurrentContext
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Debugf("Unable to cache the endpoint of cluster %s: %s", clusterID, err)
 	}
+	return selected, nil
+}
 
-	currentToken := currentRancherServer.AccessKey
-	// bearerToken intentionally keeps any "ext/" prefix on AccessKey because
-	// the ext API authenticator parses the prefix back out of the Bearer header.
-	bearerToken := currentRancherServer.AccessKey + ":" + currentRancherServer.SecretKey
+// kubeConfigTokenFresh reports whether the token of a cached kubeconfig can be
+// used at now without validating it against the server: until shortly before
+// its expiry, or for an interval after its last validation if it doesn't
+// expire.
+func kubeConfigTokenFresh(token *config.KubeConfigToken, now time.Time) bool {
+	if token == nil {
+		return false
+	}
+	if token.ExpiresAt != nil {
+		return now.Before(token.ExpiresAt.Add(-kubeConfigExpiryMargin))
+	}
+	return now.Before(token.ValidatedAt.Add(kubeConfigRevalidateInterval))
+}
 
-	// Norman's MasterClient does not expose its underlying http.Client, so
-	// build a parallel one here for the direct ext API call.
-	tlsConf, err := getTLSConfig(false, currentRancherServer.CACerts)
+func newKubeConfigResolver(ctx context.Context, cmd *cli.Command, revalidate bool) (*kubeConfigResolver, error) {
+	c, err := GetClient(cmd)
 	if err != nil {
-		return fmt.Errorf("error creating TLS config: %w", err)
+		return nil, err
 	}
-	httpClient, err := newHTTPClient(currentRancherServer, tlsConf)
+
+	config, err := loadConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	currentRancherServer, err := config.GetCurrentServer()
 	if err != nil {
-		return fmt.Errorf("error creating HTTP client: %w", err)
+		return nil, err
 	}
-	baseURL, err := currentRancherServer.EnvironmentURL()
+
+	tokenAPI, err := serverTokenAPIFor(currentRancherServer)
 	if err != nil {
-		return fmt.Errorf("error resolving server base URL: %w", err)
+		return nil, err
 	}
 	extGetter := func(ctx context.Context, id string) (*extv1.Token, error) {
-		return getExtToken(ctx, id, baseURL, bearerToken, httpClient)
+		return getExtToken(ctx, id, tokenAPI.baseURL, tokenAPI.bearerToken, tokenAPI.client)
 	}
 	v3ByID := c.ManagementClient.Token.ByID
 
-	currentUser, err := getTokenUserID(ctx, currentToken, v3ByID, extGetter)
+	currentUser, err := getTokenUserID(ctx, currentRancherServer.AccessKey, v3ByID, extGetter)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	kubeConfig, err := getKubeConfigForUser(cmd, currentUser)
+
+	return &kubeConfigResolver{
+		cmd:        cmd,
+		client:     c,
+		user:       currentUser,
+		v3ByID:     v3ByID,
+		extGetter:  extGetter,
+		revalidate: revalidate,
+	}, nil
+}
+
+// kubeConfig returns the kubeconfig of the cluster with the given ID.
+func (r *kubeConfigResolver) kubeConfig(ctx context.Context, clusterID string) (*api.Config, error) {
+	kubeConfig, token, err := getKubeConfigForUser(r.cmd, r.user, clusterID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	now := time.Now()
+	if kubeConfig != nil && !r.revalidate && kubeConfigTokenFresh(token, now) &&
+		token.AccessKey == r.client.UserConfig.AccessKey {
+		return kubeConfig, nil
 	}
 
-	var isTokenValid bool
+	var (
+		isTokenValid bool
+		expiresAt    *time.Time
+	)
 	if kubeConfig != nil {
 		tokenID, err := extractKubeconfigTokenID(*kubeConfig)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		isTokenValid, err = validateToken(ctx, tokenID, v3ByID, extGetter)
+		isTokenValid, expiresAt, err = validateTokenExpiry(ctx, tokenID, r.v3ByID, r.extGetter)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if kubeConfig == nil || !isTokenValid {
-		cluster, err := getClusterByID(c, c.UserConfig.GetCurrentCluster())
+		cluster, err := getClusterByID(r.client, clusterID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		config, err := c.ManagementClient.Cluster.ActionGenerateKubeconfig(cluster)
+		config, err := r.client.ManagementClient.Cluster.ActionGenerateKubeconfig(cluster)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		kubeConfigBytes := []byte(config.Config)
 		kubeConfig, err = clientcmd.Load(kubeConfigBytes)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if err := setKubeConfigForUser(cmd, currentUser, kubeConfig); err != nil {
-			return err
+		// The expiry of the new token is only known from the server, without
+		// it the kubeconfig is validated again after an interval.
+		expiresAt = nil
+		if tokenID, err := extractKubeconfigTokenID(*kubeConfig); err == nil {
+			if _, tokenExpiresAt, err := validateTokenExpiry(ctx, tokenID, r.v3ByID, r.extGetter); err == nil {
+				expiresAt = tokenExpiresAt
+			}
 		}
 	}
 
-	tmpfile, err := os.CreateTemp("", "rancher-")
-	if err != nil {
-		return err
+	token = &config.KubeConfigToken{
+		AccessKey:   r.client.UserConfig.AccessKey,
+		ClusterID:   clusterID,
+		ExpiresAt:   expiresAt,
+		ValidatedAt: now,
 	}
-	defer os.Remove(tmpfile.Name())
+	if err := setKubeConfigForUser(r.cmd, r.user, clusterID, kubeConfig, token); err != nil {
+		return nil, err
+	}
+	return kubeConfig, nil
+}
 
-	if err := clientcmd.WriteToFile(*kubeConfig, tmpfile.Name()); err != nil {
+// runWithKubeConfig runs the command with KUBECONFIG set to a secret file in
+// secretsDir holding kubeConfig, which is removed once the command exits.
+// inherit is set for commands reading the kubeconfig themselves, see
+// secretFiles.Add.
+func runWithKubeConfig(secretsDir string, kubeConfig *api.Config, inherit bool, path string, args []string) error {
+	return execWithKubeConfig(secretsDir, kubeConfig, inherit, path, args, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// execWithKubeConfig is like runWithKubeConfig, with the given standard
+// streams.
+func execWithKubeConfig(secretsDir string, kubeConfig *api.Config, inherit bool, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	content, err := clientcmd.Write(*kubeConfig)
+	if err != nil {
 		return err
 	}
-	if err := tmpfile.Close(); err != nil {
+
+	secrets, err := newSecretFiles(secretsDir)
+	if err != nil {
 		return err
 	}
-
-	execCmd := exec.Command(path, cmd.Args().Slice()...)
-	execCmd.Env = append(os.Environ(), "KUBECONFIG="+tmpfile.Name())
-	execCmd.Stdout = os.Stdout
-	execCmd.Stderr = os.Stderr
-	execCmd.Stdin = os.Stdin
-	err = execCmd.Run()
+	kubeConfigPath, err := secrets.Add("kubeconfig", content, inherit)
 	if err != nil {
+		secrets.Remove()
 		return err
 	}
-	return nil
+
+	execCmd := exec.Command(path, args...)
+	execCmd.Env = append(os.Environ(), "KUBECONFIG="+kubeConfigPath)
+	execCmd.Stdout = stdout
+	execCmd.Stderr = stderr
+	execCmd.Stdin = stdin
+	return secrets.Run(execCmd)
 }
 
 func extractKubeconfigTokenID(kubeconfig api.Config) (string, error) {
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// endpointRancher reaches the clusters through the Rancher proxy.
+	endpointRancher = "rancher"
+	// endpointACE reaches the clusters directly through their Authorized
+	// Cluster Endpoint.
+	endpointACE = "ace"
+	// endpointAuto prefers a reachable Authorized Cluster Endpoint, falling
+	// back to the Rancher proxy.
+	endpointAuto = "auto"
+)
+
+// endpointProbeTimeout is how long the Authorized Cluster Endpoints are given
+// to answer when checking which are reachable.
+const endpointProbeTimeout = 3 * time.Second
+
+// kubeEndpoint is a context of a kubeconfig generated by Rancher, reaching the
+// cluster through the Rancher proxy or an Authorized Cluster Endpoint, an FQDN
+// or a control plane node.
+type kubeEndpoint struct {
+	Context string
+	Cluster *api.Cluster
+	ACE     bool
+}
+
+// endpointProbeFunc reports whether the cluster of a kubeconfig is reachable.
+type endpointProbeFunc func(ctx context.Context, cluster *api.Cluster) error
+
+// validateKubeEndpoint returns an error if endpoint isn't a known endpoint.
+// The empty endpoint keeps the current context of the kubeconfig.
+func validateKubeEndpoint(endpoint string) error {
+	switch endpoint {
+	case "", endpointRancher, endpointACE, endpointAuto:
+		return nil
+	}
+	return fmt.Errorf("invalid --endpoint %q, must be one of %s, %s or %s", endpoint, endpointRancher, endpointACE, endpointAuto)
+}
+
+// kubeEndpoints returns the contexts of kubeConfig by name, the contexts whose
+// server is the Rancher proxy, under /k8s/clusters/, being the others.
+func kubeEndpoints(kubeConfig *api.Config) []kubeEndpoint {
+	var endpoints []kubeEndpoint
+	for _, name := range slices.Sorted(maps.Keys(kubeConfig.Contexts)) {
+		kubeContext := kubeConfig.Contexts[name]
+		if kubeContext == nil {
+			continue
+		}
+		cluster := kubeConfig.Clusters[kubeContext.Cluster]
+		if cluster == nil {
+			continue
+		}
+		ace := true
+		if u, err := url.Parse(cluster.Server); err == nil && strings.Contains(u.Path, "/k8s/clusters/") {
+			ace = false
+		}
+		endpoints = append(endpoints, kubeEndpoint{Context: name, Cluster: cluster, ACE: ace})
+	}
+	return endpoints
+}
+
+// kubeConfigClusterID returns the ID of the cluster of a kubeconfig generated
+// by Rancher, found in the server of its Rancher proxy context, or "" if it
+// has none.
+func kubeConfigClusterID(kubeConfig *api.Config) string {
+	for _, e := range kubeEndpoints(kubeConfig) {
+		if e.ACE {
+			continue
+		}
+		u, err := url.Parse(e.Cluster.Server)
+		if err != nil {
+			continue
+		}
+		_, id, _ := strings.Cut(u.Path, "/k8s/clusters/")
+		if id, _, _ = strings.Cut(id, "/"); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// selectKubeEndpoint returns a copy of kubeConfig whose current context is the
+// given endpoint. With endpointAuto, the first Authorized Cluster Endpoint
+// found reachable by probe is selected, or the Rancher proxy if there's none.
+func selectKubeEndpoint(ctx context.Context, kubeConfig *api.Config, endpoint string, probe endpointProbeFunc) (*api.Config, error) {
+	if endpoint == "" {
+		return kubeConfig, nil
+	}
+
+	var proxies, aces []kubeEndpoint
+	for _, e := range kubeEndpoints(kubeConfig) {
+		if e.ACE {
+			aces = append(aces, e)
+		} else {
+			proxies = append(proxies, e)
+		}
+	}
+	// the current context is preferred among endpoints of the same kind
+	current := func(endpoints []kubeEndpoint) []kubeEndpoint {
+		i := slices.IndexFunc(endpoints, func(e kubeEndpoint) bool { return e.Context == kubeConfig.CurrentContext })
+		if i > 0 {
+			endpoints = append([]kubeEndpoint{endpoints[i]}, slices.Delete(slices.Clone(endpoints), i, i+1)...)
+		}
+		return endpoints
+	}
+	proxies, aces = current(proxies), current(aces)
+
+	var selected *kubeEndpoint
+	switch endpoint {
+	case endpointRancher:
+		if len(proxies) == 0 {
+			return nil, errors.New("the kubeconfig has no context for the Rancher proxy")
+		}
+		selected = &proxies[0]
+	case endpointACE:
+		if len(aces) == 0 {
+			return nil, errors.New("the cluster has no authorized cluster endpoint")
+		}
+		selected = &aces[0]
+	case endpointAuto:
+		if i := firstReachable(ctx, aces, probe); i >= 0 {
+			selected = &aces[i]
+		} else if len(proxies) > 0 {
+			selected = &proxies[0]
+		} else if len(aces) > 0 {
+			// no endpoint is reachable, let kubectl report the error
+			selected = &aces[0]
+		} else {
+			return nil, errors.New("the kubeconfig has no context")
+		}
+	default:
+		return nil, validateKubeEndpoint(endpoint)
+	}
+
+	logrus.Debugf("Using the context %s, server %s", selected.Context, selected.Cluster.Server)
+	out := kubeConfig.DeepCopy()
+	out.CurrentContext = selected.Context
+	return out, nil
+}
+
+// firstReachable probes the endpoints concurrently and returns the index of
+// the first one that is reachable, -1 if none is.
+func firstReachable(ctx context.Context, endpoints []kubeEndpoint, probe endpointProbeFunc) int {
+	reachable := make([]bool, len(endpoints))
+	var wg sync.WaitGroup
+	for i, e := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := probe(ctx, e.Cluster); err != nil {
+				logrus.Debugf("Authorized cluster endpoint %s is unreachable: %s", e.Cluster.Server, err)
+				return
+			}
+			reachable[i] = true
+		}()
+	}
+	wg.Wait()
+	return slices.Index(reachable, true)
+}
+
+// probeKubeEndpoint reports whether a TLS connection can be established with
+// the server of the cluster, trusting its certificate authority.
+func probeKubeEndpoint(ctx context.Context, cluster *api.Cluster) error {
+	u, err := url.Parse(cluster.Server)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cluster.InsecureSkipTLSVerify,
+	}
+	if cluster.TLSServerName != "" {
+		tlsConfig.ServerName = cluster.TLSServerName
+	}
+	caData := cluster.CertificateAuthorityData
+	if len(caData) == 0 && cluster.CertificateAuthority != "" {
+		if caData, err = os.ReadFile(cluster.CertificateAuthority); err != nil {
+			return err
+		}
+	}
+	if len(caData) > 0 {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caData) {
+			return errors.New("invalid certificate authority data")
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newGeneratedKubeConfig returns a kubeconfig like the ones generated by
+// Rancher for a cluster with authorized cluster endpoints.
+func newGeneratedKubeConfig() *api.Config {
+	kubeConfig := api.NewConfig()
+	kubeConfig.Clusters["downstream"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-12345"}
+	kubeConfig.Clusters["downstream-cp-1"] = &api.Cluster{Server: "https://10.0.0.1:6443"}
+	kubeConfig.Clusters["downstream-cp-2"] = &api.Cluster{Server: "https://10.0.0.2:6443"}
+	for name := range kubeConfig.Clusters {
+		kubeConfig.Contexts[name] = &api.Context{Cluster: name, AuthInfo: "downstream"}
+	}
+	kubeConfig.AuthInfos["downstream"] = &api.AuthInfo{Token: "kubeconfig-u-abcde:secret"}
+	kubeConfig.CurrentContext = "downstream"
+	return kubeConfig
+}
+
+func TestSelectKubeEndpoint(t *testing.T) {
+	t.Parallel()
+
+	reachable := func(servers ...string) endpointProbeFunc {
+		return func(_ context.Context, cluster *api.Cluster) error {
+			for _, server := range servers {
+				if cluster.Server == server {
+					return nil
+				}
+			}
+			return errors.New("connection refused")
+		}
+	}
+
+	tests := []struct {
+		name        string
+		endpoint    string
+		probe       endpointProbeFunc
+		expected    string
+		expectedErr string
+	}{
+		{name: "current context", endpoint: "", expected: "downstream"},
+		{name: "rancher", endpoint: "rancher", expected: "downstream"},
+		{name: "ace", endpoint: "ace", expected: "downstream-cp-1"},
+		{name: "auto, first reachable", endpoint: "auto", probe: reachable("https://10.0.0.2:6443"), expected: "downstream-cp-2"},
+		{name: "auto, unreachable", endpoint: "auto", probe: reachable(), expected: "downstream"},
+		{name: "invalid", endpoint: "direct", expectedErr: `invalid --endpoint "direct", must be one of rancher, ace or auto`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			kubeConfig := newGeneratedKubeConfig()
+			selected, err := selectKubeEndpoint(t.Context(), kubeConfig, tt.endpoint, tt.probe)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, selected.CurrentContext)
+			// the kubeconfig is copied
+			assert.Equal(t, "downstream", kubeConfig.CurrentContext)
+		})
+	}
+}
+
+func TestKubeConfigClusterID(t *testing.T) {
+	t.Parallel()
+
+	kubeConfig := newGeneratedKubeConfig()
+	assert.Equal(t, "c-12345", kubeConfigClusterID(kubeConfig))
+
+	delete(kubeConfig.Contexts, "downstream")
+	assert.Empty(t, kubeConfigClusterID(kubeConfig))
+}
+
+func TestSelectKubeEndpointWithoutACE(t *testing.T) {
+	t.Parallel()
+
+	kubeConfig := newGeneratedKubeConfig()
+	delete(kubeConfig.Contexts, "downstream-cp-1")
+	delete(kubeConfig.Contexts, "downstream-cp-2")
+
+	_, err := selectKubeEndpoint(t.Context(), kubeConfig, "ace", nil)
+	assert.EqualError(t, err, "the cluster has no authorized cluster endpoint")
+
+	selected, err := selectKubeEndpoint(t.Context(), kubeConfig, "auto", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "downstream", selected.CurrentContext)
+}
+
+func TestProbeKubeEndpoint(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	err := probeKubeEndpoint(t.Context(), &api.Cluster{Server: server.URL, CertificateAuthorityData: caData})
+	assert.NoError(t, err)
+
+	// the certificate isn't trusted without the CA
+	err = probeKubeEndpoint(t.Context(), &api.Cluster{Server: server.URL})
+	assert.Error(t, err)
+
+	server.Close()
+	err = probeKubeEndpoint(t.Context(), &api.Cluster{Server: server.URL, CertificateAuthorityData: caData})
+	assert.Error(t, err)
+}
@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/rancher/norman/types"
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestParseKubectlArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		args        []string
+		expected    kubectlOptions
+		expectedErr string
+	}{
+		{
+			name:     "kubectl arguments only",
+			args:     []string{"get", "pods", "--cluster", "kind"},
+			expected: kubectlOptions{parallel: 4, args: []string{"get", "pods", "--cluster", "kind"}},
+		},
+		{
+			name:     "cluster",
+			args:     []string{"--cluster", "downstream", "get", "nodes"},
+			expected: kubectlOptions{parallel: 4, selectors: []string{"downstream"}, args: []string{"get", "nodes"}},
+		},
+		{
+			name: "clusters",
+			args: []string{"--clusters=prod-*, staging", "--parallel", "2", "get", "pods"},
+			expected: kubectlOptions{
+				parallel:  2,
+				selectors: []string{"prod-*", "staging"},
+				fanOut:    true,
+				args:      []string{"get", "pods"},
+			},
+		},
+		{
+			name:     "all clusters",
+			args:     []string{"--all-clusters", "version"},
+			expected: kubectlOptions{parallel: 4, allClusters: true, fanOut: true, args: []string{"version"}},
+		},
+		{
+			name:     "endpoint",
+			args:     []string{"--endpoint=auto", "get", "pods"},
+			expected: kubectlOptions{parallel: 4, endpoint: "auto", args: []string{"get", "pods"}},
+		},
+		{
+			name:        "invalid endpoint",
+			args:        []string{"--endpoint", "direct", "get", "pods"},
+			expectedErr: `invalid --endpoint "direct", must be one of rancher, ace or auto`,
+		},
+		{
+			name:     "revalidate",
+			args:     []string{"--revalidate", "get", "pods", "--revalidate"},
+			expected: kubectlOptions{parallel: 4, revalidate: true, args: []string{"get", "pods", "--revalidate"}},
+		},
+		{
+			name:        "missing value",
+			args:        []string{"--cluster"},
+			expectedErr: "--cluster requires a value",
+		},
+		{
+			name:        "invalid parallel",
+			args:        []string{"--parallel=0", "get", "pods"},
+			expectedErr: `invalid --parallel "0", must be a positive number`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts, err := parseKubectlArgs(tt.args)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, opts)
+		})
+	}
+}
+
+func TestSelectClusters(t *testing.T) {
+	t.Parallel()
+
+	clusters := []managementClient.Cluster{
+		{Resource: types.Resource{ID: "local"}, Name: "local"},
+		{Resource: types.Resource{ID: "c-12345"}, Name: "prod-eu"},
+		{Resource: types.Resource{ID: "c-67890"}, Name: "prod-us"},
+		{Resource: types.Resource{ID: "c-abcde"}},
+	}
+	names := func(selected []kubeconfigCluster) []string {
+		var names []string
+		for _, cluster := range selected {
+			names = append(names, cluster.Name)
+		}
+		return names
+	}
+
+	selected, err := selectClusters(clusters, []string{"prod-*", "c-12345", "c-abcde"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prod-eu", "prod-us", "c-abcde"}, names(selected))
+
+	selected, err = selectClusters(clusters, nil, true)
+	require.NoError(t, err)
+	assert.Len(t, selected, 4)
+
+	_, err = selectClusters(clusters, []string{"staging"}, false)
+	assert.EqualError(t, err, "no cluster matches \"staging\", run `rancher clusters` to see available clusters")
+
+	_, err = selectClusters(clusters, []string{"prod-["}, false)
+	assert.ErrorContains(t, err, `invalid cluster selector "prod-["`)
+}
+
+func TestCachedKubeConfig(t *testing.T) {
+	t.Parallel()
+
+	expiresAt := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	newKubeConfig := func(token string) *api.Config {
+		kubeConfig := api.NewConfig()
+		kubeConfig.AuthInfos["user"] = &api.AuthInfo{Token: token}
+		return kubeConfig
+	}
+	serverConfig := &config.ServerConfig{
+		AccessKey: "token-abcde",
+		KubeConfigs: map[string]*api.Config{
+			"u-abcde-local":   newKubeConfig("kubeconfig-u-abcde:local"),
+			"u-abcde-c-12345": newKubeConfig("kubeconfig-u-abcde:c-12345"),
+			"u-fghij-c-abcde": newKubeConfig("kubeconfig-u-fghij:c-abcde"),
+		},
+		KubeConfigTokens: map[string]*config.KubeConfigToken{
+			"u-abcde-local":   {AccessKey: "token-abcde", ClusterID: "local"},
+			"u-abcde-c-12345": {AccessKey: "token-abcde", ClusterID: "c-12345", ExpiresAt: &expiresAt},
+			"u-fghij-c-abcde": {AccessKey: "token-fghij", ClusterID: "c-abcde", ExpiresAt: &expiresAt},
+		},
+	}
+
+	kubeConfig, token := cachedKubeConfig(serverConfig, "c-12345")
+	assert.Equal(t, serverConfig.KubeConfigs["u-abcde-c-12345"], kubeConfig)
+	assert.Equal(t, serverConfig.KubeConfigTokens["u-abcde-c-12345"], token)
+
+	// generated with another access key
+	kubeConfig, token = cachedKubeConfig(serverConfig, "c-abcde")
+	assert.Nil(t, kubeConfig)
+	assert.Nil(t, token)
+
+	kubeConfig, _ = cachedKubeConfig(serverConfig, "")
+	assert.Nil(t, kubeConfig)
+
+	// cached by an older version of the CLI, without a token, and looked up
+	// by cluster name
+	legacy := newGeneratedKubeConfig()
+	legacy.Clusters["downstream"].Server = "https://rancher.example.com/k8s/clusters/c-67890"
+	serverConfig.KubeConfigs["u-abcde-c-67890"] = legacy
+	kubeConfig, token = cachedKubeConfig(serverConfig, "c-12345")
+	assert.Equal(t, serverConfig.KubeConfigs["u-abcde-c-12345"], kubeConfig)
+	assert.NotNil(t, token)
+	kubeConfig, token = cachedKubeConfig(serverConfig, "downstream")
+	assert.Same(t, legacy, kubeConfig)
+	assert.Nil(t, token)
+}
+
+// newKubectlTestCommand returns a command using a config holding
+// serverConfig as its current server.
+func newKubectlTestCommand(t *testing.T, serverConfig *config.ServerConfig) *cli.Command {
+	t.Helper()
+
+	var cliCmd *cli.Command
+	app := &cli.Command{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config"},
+		},
+		Action: func(_ context.Context, c *cli.Command) error {
+			cliCmd = c
+			return nil
+		},
+	}
+	require.NoError(t, app.Run(context.Background(), []string{"test", "--config=" + t.TempDir()}))
+
+	require.NoError(t, config.Update(GetConfigPath(cliCmd), func(cf *config.Config) error {
+		cf.Servers["rancherDefault"] = serverConfig
+		cf.CurrentServer = "rancherDefault"
+		return nil
+	}))
+	return cliCmd
+}
+
+func TestKubectlClustersOffline(t *testing.T) {
+	t.Parallel()
+
+	// a server that can't be reached
+	unavailable := httptest.NewServer(http.NotFoundHandler())
+	unavailable.Close()
+
+	staging := newGeneratedKubeConfig()
+	staging.Clusters["downstream"].Server = unavailable.URL + "/k8s/clusters/c-67890"
+	staging.CurrentContext = "downstream-cp-1"
+	cmd := newKubectlTestCommand(t, &config.ServerConfig{
+		URL:       unavailable.URL,
+		AccessKey: "token-abcde",
+		SecretKey: "secret",
+		KubeConfigs: map[string]*api.Config{
+			"u-abcde-c-12345": newGeneratedKubeConfig(),
+			// cached by an older version of the CLI
+			"u-abcde-c-67890": staging,
+		},
+		KubeConfigTokens: map[string]*config.KubeConfigToken{
+			"u-abcde-c-12345": {AccessKey: "token-abcde", ClusterID: "c-12345"},
+		},
+	})
+
+	opts := kubectlOptions{selectors: []string{"downstream", "c-67890"}, endpoint: endpointAuto}
+	clusters, kubeConfigFor, err := kubectlClusters(t.Context(), cmd, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []kubeconfigCluster{{Name: "downstream", ID: "c-12345"}, {Name: "downstream-cp-1", ID: "c-67890"}}, clusters)
+	kubeConfig, err := kubeConfigFor(t.Context(), "c-67890")
+	require.NoError(t, err)
+	assert.Equal(t, staging.Clusters["downstream"].Server, kubeConfig.Clusters["downstream"].Server)
+
+	// the clusters reached through the Rancher proxy need the server
+	opts.endpoint = endpointRancher
+	_, _, err = kubectlClusters(t.Context(), cmd, opts)
+	assert.Error(t, err)
+
+	// unknown clusters report the error of the server
+	opts = kubectlOptions{selectors: []string{"prod"}, endpoint: endpointACE}
+	_, _, err = kubectlClusters(t.Context(), cmd, opts)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "no cluster matches")
+}
+
+func TestSelectCachedKubeEndpoint(t *testing.T) {
+	t.Parallel()
+
+	// authorized cluster endpoints refusing connections
+	unavailable := httptest.NewServer(http.NotFoundHandler())
+	unavailable.Close()
+	kubeConfig := newGeneratedKubeConfig()
+	kubeConfig.Clusters["downstream-cp-1"].Server = unavailable.URL
+	kubeConfig.Clusters["downstream-cp-2"].Server = unavailable.URL
+
+	expiresAt := time.Now().Add(time.Hour)
+	cmd := newKubectlTestCommand(t, &config.ServerConfig{
+		URL:         "https://rancher.example.com",
+		AccessKey:   "token-abcde",
+		KubeConfigs: map[string]*api.Config{"u-abcde-c-12345": kubeConfig},
+		KubeConfigTokens: map[string]*config.KubeConfigToken{
+			"u-abcde-c-12345": {AccessKey: "token-abcde", ClusterID: "c-12345", ExpiresAt: &expiresAt},
+		},
+	})
+	cachedEndpoint := func() string {
+		cf, err := loadConfig(cmd)
+		require.NoError(t, err)
+		return cf.Servers["rancherDefault"].KubeConfigTokens["u-abcde-c-12345"].Endpoint
+	}
+
+	selected, err := selectCachedKubeEndpoint(t.Context(), cmd, kubeConfig, endpointAuto)
+	require.NoError(t, err)
+	assert.Equal(t, "downstream", selected.CurrentContext)
+	assert.Equal(t, "downstream", cachedEndpoint())
+
+	// the cached endpoint is used without probing the endpoints again
+	require.NoError(t, updateConfig(cmd, func(cf *config.Config) error {
+		cf.Servers["rancherDefault"].KubeConfigTokens["u-abcde-c-12345"].Endpoint = "downstream-cp-2"
+		return nil
+	}))
+	selected, err = selectCachedKubeEndpoint(t.Context(), cmd, kubeConfig, endpointAuto)
+	require.NoError(t, err)
+	assert.Equal(t, "downstream-cp-2", selected.CurrentContext)
+
+	// other endpoints don't use it
+	selected, err = selectCachedKubeEndpoint(t.Context(), cmd, kubeConfig, endpointRancher)
+	require.NoError(t, err)
+	assert.Equal(t, "downstream", selected.CurrentContext)
+}
+
+func TestKubeConfigTokenFresh(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+
+	tests := []struct {
+		name     string
+		token    *config.KubeConfigToken
+		expected bool
+	}{
+		{name: "not cached", token: nil, expected: false},
+		{name: "far from expiry", token: &config.KubeConfigToken{ExpiresAt: at(time.Hour)}, expected: true},
+		{name: "near expiry", token: &config.KubeConfigToken{ExpiresAt: at(4 * time.Minute)}, expected: false},
+		{name: "expired", token: &config.KubeConfigToken{ExpiresAt: at(-time.Minute)}, expected: false},
+		{name: "not expiring, validated recently", token: &config.KubeConfigToken{ValidatedAt: *at(-time.Minute)}, expected: true},
+		{name: "not expiring, validated long ago", token: &config.KubeConfigToken{ValidatedAt: *at(-2 * time.Hour)}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.expected, kubeConfigTokenFresh(tt.token, now))
+		})
+	}
+}
+
+func TestRunOnClusters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	t.Parallel()
+
+	clusters := []kubeconfigCluster{
+		{Name: "local", ID: "local"},
+		{Name: "prod-eu", ID: "c-12345"},
+		{Name: "prod-us", ID: "c-67890"},
+	}
+
+	var running, maxRunning atomic.Int32
+	run := func(ctx context.Context, cluster kubeconfigCluster, stdout, stderr io.Writer) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		switch cluster.ID {
+		case "c-12345":
+			// kubectl failing with exit code 2
+			execCmd := exec.Command("sh", "-c", "echo forbidden >&2; exit 2")
+			execCmd.Stdout = stdout
+			execCmd.Stderr = stderr
+			return execCmd.Run()
+		case "c-67890":
+			return errors.New("cluster unavailable")
+		}
+		fmt.Fprint(stdout, "node-1\nnode-2")
+		return nil
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := runOnClusters(context.Background(), clusters, 2, stdout, stderr, run)
+
+	var exitErr cli.ExitCoder
+	require.True(t, errors.As(err, &exitErr), "unexpected error %v", err)
+	assert.Equal(t, 2, exitErr.ExitCode())
+	assert.EqualError(t, err, "failed on 2 of 3 clusters: prod-eu, prod-us")
+	assert.LessOrEqual(t, maxRunning.Load(), int32(2))
+
+	assert.Equal(t, "local   | node-1\nlocal   | node-2\n", stdout.String())
+	errLines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	sort.Strings(errLines)
+	assert.Equal(t, []string{"prod-eu | forbidden", "prod-us | error: cluster unavailable"}, errLines)
+}
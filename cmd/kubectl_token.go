@@ -4,12 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,7 +15,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
@@ -26,9 +22,9 @@ import (
 
 	"github.com/rancher/cli/config"
 	apiv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
-	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	"github.com/tidwall/gjson"
 	"github.com/urfave/cli/v3"
+	"golang.org/x/oauth2"
 	"golang.org/x/term"
 )
 
@@ -57,6 +53,24 @@ type LoginInput struct {
 	caCerts      string
 	skipVerify   bool
 	authFlow     string // devicecode or authcode.
+	responseType string // kubeconfig by default.
+	// nonInteractive refuses to prompt the user, when kubectl doesn't pass stdin.
+	nonInteractive bool
+	// oauthToken is the token issued by the OAuth provider the user logged in with.
+	oauthToken *oauth2.Token
+	saml       samlOptions
+}
+
+// loginResponseType returns the type of token requested when logging in: a
+// kubeconfig token, scoped to the cluster if any, unless set otherwise.
+func (input *LoginInput) loginResponseType() string {
+	if input.responseType != "" {
+		return input.responseType
+	}
+	if input.clusterID != "" {
+		return fmt.Sprintf("kubeconfig_%s", input.clusterID)
+	}
+	return "kubeconfig"
 }
 
 const (
@@ -77,7 +91,11 @@ var samlProviders = map[string]bool{
 }
 
 var oauthProviders = map[string]bool{
-	"azureADProvider": true,
+	"azureADProvider":      true,
+	"genericOIDCProvider":  true,
+	"keyCloakOIDCProvider": true,
+	"githubProvider":       true,
+	"googleOAuthProvider":  true,
 }
 
 var supportedAuthProviders = map[string]bool{
@@ -94,7 +112,11 @@ var supportedAuthProviders = map[string]bool{
 	"shibbolethProvider": true,
 
 	// oauth providers
-	"azureADProvider": true,
+	"azureADProvider":      true,
+	"genericOIDCProvider":  true,
+	"keyCloakOIDCProvider": true,
+	"githubProvider":       true,
+	"googleOAuthProvider":  true,
 }
 
 func CredentialCommand() *cli.Command {
@@ -110,19 +132,11 @@ func CredentialCommand() *cli.Command {
 		Name:   "token",
 		Usage:  "Authenticate and generate new kubeconfig token",
 		Action: runCredential,
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:  "server",
-				Usage: "Name of rancher server",
-			},
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:  "user",
 				Usage: "user-id",
 			},
-			&cli.StringFlag{
-				Name:  "cluster",
-				Usage: "cluster-id",
-			},
 			&cli.StringFlag{
 				Name:  "auth-provider",
 				Usage: "Name of Auth Provider to use for authentication",
@@ -139,13 +153,29 @@ func CredentialCommand() *cli.Command {
 				Name:  "skip-verify",
 				Usage: "Skip verification of the CACerts presented by the Server",
 			},
-		},
+			&cli.BoolFlag{
+				Name:  "client-cert",
+				Usage: "Return a client certificate signed by the cluster instead of a token, for authorized cluster endpoints",
+			},
+			&cli.DurationFlag{
+				Name:  "cert-ttl",
+				Usage: "Lifetime of the client certificate, at least 10m",
+				Value: defaultClientCertTTL,
+			},
+			&cli.DurationFlag{
+				Name:  "cert-approval-timeout",
+				Usage: "How long to wait for a cluster admin to approve the client certificate when it can't be approved by the user, only in a terminal",
+				Value: defaultCSRApprovalTimeout,
+			},
+		}, samlFlags()...),
 		Commands: []*cli.Command{
 			{
 				Name:   "delete",
 				Usage:  fmt.Sprintf("Delete cached token used for kubectl login at [%s] \n %s", configDir, deleteExample),
 				Action: deleteCachedCredential,
 			},
+			tokenLsCommand(),
+			tokenPruneCommand(),
 		},
 	}
 }
@@ -168,20 +198,40 @@ func runCredential(ctx context.Context, cmd *cli.Command) error {
 	if userID == "" {
 		return errors.New("user-id is required")
 	}
+	execInfo, err := readExecInfo()
+	if err != nil {
+		return err
+	}
 	clusterID := cmd.String("cluster")
+	if clusterID == "" {
+		clusterID = clusterIDFromExecInfo(execInfo)
+	}
 
-	serverConfig, err := lookupServerConfig(cmd)
+	cf, serverConfig, err := lookupServerConfig(cmd)
 	if err != nil {
 		return fmt.Errorf("error looking up server config: %w", err)
 	}
+	creds, err := cf.LoadCredentials()
+	if err != nil {
+		return fmt.Errorf("error loading cached credentials: %w", err)
+	}
+
+	clientCert := cmd.Bool("client-cert")
+	if clientCert && clusterID == "" {
+		return errors.New("cluster-id is required for client certificates")
+	}
 
 	cachedCredName := fmt.Sprintf("%s_%s", userID, clusterID)
-	cachedCred, err := loadCachedCredential(cmd, serverConfig, cachedCredName)
+	outputCredName := cachedCredName
+	if clientCert {
+		outputCredName += clientCertCredSuffix
+	}
+	cachedCred, err := loadCachedCredential(cf, creds, server, outputCredName)
 	if err != nil {
 		customPrint(fmt.Errorf("LoadToken: %v", err))
 	}
 	if cachedCred != nil {
-		return json.NewEncoder(os.Stdout).Encode(cachedCred)
+		return writeExecCredential(os.Stdout, cachedCred, execInfo)
 	}
 
 	input := &LoginInput{
@@ -192,28 +242,80 @@ func runCredential(ctx context.Context, cmd *cli.Command) error {
 		caCerts:      cmd.String("cacerts"),
 		skipVerify:   cmd.Bool("skip-verify"),
 		authFlow:     cmd.String("auth-flow"),
+
+		nonInteractive: !execInfoInteractive(execInfo),
+		saml:           newSAMLOptions(cmd, cf.SecretBackend),
 	}
 
-	tlsConfig, err := getTLSConfig(input.skipVerify, input.caCerts)
+	client, err := newCredentialHTTPClient(serverConfig, input)
 	if err != nil {
 		return err
 	}
 
-	client, err := newHTTPClient(serverConfig, tlsConfig)
+	var newCred *config.ExecCredential
+	if clientCert {
+		// the token used to request the certificate may still be valid
+		if newCred, err = loadCachedCredential(cf, creds, server, cachedCredName); err != nil {
+			customPrint(fmt.Errorf("LoadToken: %v", err))
+		}
+	}
+	if newCred == nil {
+		newCred, err = newTokenCredential(ctx, cmd, cf, client, serverConfig, input, cachedCredName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if clientCert {
+		newCred, err = clientCertCredential(ctx, client, input, newCred.Status.Token, cmd.Duration("cert-ttl"), cmd.Duration("cert-approval-timeout"))
+		if err != nil {
+			return err
+		}
+		if err := cacheCredential(cf, server, outputCredName, newCred); err != nil {
+			customPrint(fmt.Errorf("CacheCertificate: %v", err))
+		}
+	}
+
+	return writeExecCredential(os.Stdout, newCred, execInfo)
+}
+
+// newCredentialHTTPClient returns the client logging in to the server for a
+// credential. It trusts the CA certs of --cacerts or, without it, the CA certs
+// saved for the server on login, as the kubeconfigs merged by the CLI don't
+// pass --cacerts.
+func newCredentialHTTPClient(serverConfig *config.ServerConfig, input *LoginInput) (*http.Client, error) {
+	if input.caCerts == "" && !input.skipVerify {
+		return newServerHTTPClient(serverConfig)
+	}
+
+	tlsConfig, err := getTLSConfig(input.skipVerify, input.caCerts)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return newHTTPClient(serverConfig, tlsConfig)
+}
 
-	newCred, err := loginAndGenerateCred(client, input)
+// newTokenCredential renews the kubeconfig token of the user, or logs in
+// again, and caches it.
+func newTokenCredential(ctx context.Context, cmd *cli.Command, cf config.Config, client *http.Client, serverConfig *config.ServerConfig, input *LoginInput, cachedCredName string) (*config.ExecCredential, error) {
+	newCred, err := renewCredential(cmd, client, serverConfig, input)
 	if err != nil {
-		return err
+		customPrint(fmt.Sprintf("Unable to renew the token, logging in again: %v", err))
+	}
+	if newCred == nil {
+		newCred, err = loginAndGenerateCred(ctx, client, input)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err := cacheCredential(cmd, serverConfig, cachedCredName, newCred); err != nil {
+	if err := cacheCredential(cf, input.server, cachedCredName, newCred); err != nil {
 		customPrint(fmt.Errorf("CacheToken: %v", err))
 	}
-
-	return json.NewEncoder(os.Stdout).Encode(newCred)
+	if err := cacheOAuthToken(cmd, input.userID, input); err != nil {
+		customPrint(fmt.Errorf("CacheRefreshToken: %v", err))
+	}
+	return newCred, nil
 }
 
 func deleteCachedCredential(ctx context.Context, cmd *cli.Command) error {
@@ -225,151 +327,141 @@ func deleteCachedCredential(ctx context.Context, cmd *cli.Command) error {
 	if err != nil {
 		return err
 	}
+	path := cf.CredentialStorePath()
 
-	// dir is always set by global default.
-	dir := cmd.String("config")
-
-	if len(cf.Servers) == 0 {
-		customPrint(fmt.Sprintf("there are no cached tokens in [%s]", dir))
-		return nil
-	}
-
-	if cmd.Args().First() == "all" {
-		customPrint(fmt.Sprintf("removing cached tokens in [%s]", dir))
-		for _, server := range cf.Servers {
-			server.KubeCredentials = make(map[string]*config.ExecCredential)
+	return cf.UpdateCredentials(func(s *config.CredentialStore) error {
+		if len(s.Servers) == 0 {
+			customPrint(fmt.Sprintf("there are no cached tokens in [%s]", path))
+			return nil
 		}
-		return cf.Write()
-	}
 
-	for _, key := range cmd.Args().Slice() {
-		customPrint(fmt.Sprintf("removing [%s]", key))
-		for _, server := range cf.Servers {
-			delete(server.KubeCredentials, key)
+		if cmd.Args().First() == "all" {
+			customPrint(fmt.Sprintf("removing cached tokens in [%s]", path))
+			s.Servers = make(map[string]map[string]*config.ExecCredential)
+			return nil
 		}
-	}
 
-	return cf.Write()
+		for _, key := range cmd.Args().Slice() {
+			customPrint(fmt.Sprintf("removing [%s]", key))
+			for server := range s.Servers {
+				s.Delete(server, key)
+			}
+		}
+		return nil
+	})
 }
 
-func loadCachedCredential(cmd *cli.Command, serverConfig *config.ServerConfig, key string) (*config.ExecCredential, error) {
-	cred := serverConfig.KubeToken(key)
-	if cred == nil {
-		return cred, nil
+// loadCachedCredential returns the credential cached for the server under
+// key, if it's not expired. Expired credentials are removed from the store.
+func loadCachedCredential(cf config.Config, creds *config.CredentialStore, server, key string) (*config.ExecCredential, error) {
+	cred := creds.Get(server, key)
+	if cred == nil || cred.Status == nil {
+		return nil, nil
 	}
 	ts := cred.Status.ExpirationTimestamp
 	if ts != nil && ts.Before(time.Now()) {
-		cf, err := loadConfig(cmd)
-		if err != nil {
-			return nil, err
-		}
-		cf.Servers[cmd.String("server")].KubeCredentials[key] = nil
-		if err := cf.Write(); err != nil {
-			return nil, err
-		}
-		return nil, nil
+		return nil, cf.UpdateCredentials(func(s *config.CredentialStore) error {
+			s.Delete(server, key)
+			return nil
+		})
 	}
 
 	return cred, nil
 }
 
-// there is overlap between this and the lookupConfig() function. However, lookupConfig() requires
-// a server to be previously set in the Config, which might not be the case if rancher token
-// is run before rancher login. Perhaps we can depricate rancher token down the line and defer
-// all it does to login.
-func lookupServerConfig(cmd *cli.Command) (*config.ServerConfig, error) {
+// lookupServerConfig returns the config and the server configured for the
+// --server URL. rancher token may be run before rancher login, in which case
+// an unsaved server holding only the URL is returned: the credentials are
+// cached in the credential store, which doesn't depend on configured servers.
+func lookupServerConfig(cmd *cli.Command) (config.Config, *config.ServerConfig, error) {
 	server := cmd.String("server")
 	if server == "" {
-		return nil, errors.New("name of rancher server is required")
+		return config.Config{}, nil, errors.New("name of rancher server is required")
 	}
 
 	cf, err := loadConfig(cmd)
 	if err != nil {
-		return nil, err
+		return cf, nil, err
 	}
 
-	sc := cf.Servers[server]
-	if sc == nil {
-		sc = &config.ServerConfig{
-			KubeCredentials: make(map[string]*config.ExecCredential),
-		}
-		cf.Servers[server] = sc
-		if err := cf.Write(); err != nil {
-			return nil, err
-		}
+	if _, sc := cf.LookupServer(server); sc != nil {
+		return cf, sc, nil
 	}
-	return sc, nil
+	return cf, &config.ServerConfig{URL: server}, nil
 }
 
-func cacheCredential(cmd *cli.Command, serverConfig *config.ServerConfig, key string, cred *config.ExecCredential) error {
+// cacheCredential stores the credential for the server under key, the store
+// being locked so that the credentials cached by other processes are kept.
+func cacheCredential(cf config.Config, server, key string, cred *config.ExecCredential) error {
 	// cache only if valid
-	if cred.Status.Token == "" {
+	if cred.Status.Token == "" && cred.Status.ClientCertificateData == "" {
 		return nil
 	}
 
-	server := cmd.String("server")
-	if server == "" {
-		return errors.New("name of rancher server is required")
-	}
-
-	cf, err := loadConfig(cmd)
-	if err != nil {
-		return err
-	}
-
-	if serverConfig.KubeCredentials == nil {
-		serverConfig.KubeCredentials = make(map[string]*config.ExecCredential)
-	}
-	serverConfig.KubeCredentials[key] = cred
-	cf.Servers[server] = serverConfig
-
-	return cf.Write()
+	return cf.UpdateCredentials(func(s *config.CredentialStore) error {
+		s.Set(server, key, cred)
+		return nil
+	})
 }
 
-func loginAndGenerateCred(client *http.Client, input *LoginInput) (*config.ExecCredential, error) {
+// authenticate logs the user in through the selected auth provider, asking
+// for it when there are several, and returns the token created by Rancher.
+func authenticate(ctx context.Context, client *http.Client, input *LoginInput) (loginToken, error) {
 	// Try /v1-public first.
 	authProviders, useV1Public, err := getAuthProviders(client, input.server, true)
 	if err != nil {
-		return nil, err
+		return loginToken{}, err
 	}
 
+	if input.nonInteractive && input.authProvider == "" && len(authProviders) > 1 {
+		return loginToken{}, errNonInteractive
+	}
 	selectedProvider, err := selectAuthProvider(authProviders, input.authProvider)
 	if err != nil {
-		return nil, err
+		return loginToken{}, err
 	}
 	input.authProvider = selectedProvider.GetType()
 
-	var token loginToken
 	switch {
 	case samlProviders[input.authProvider]:
-		samlTok, err := samlAuth(client, input, useV1Public)
+		samlTok, err := samlAuth(ctx, client, input, useV1Public, openBrowser)
 		if err != nil {
-			return nil, err
+			return loginToken{}, err
 		}
-		token = loginToken{
+		return loginToken{
 			BearerToken: samlTok.Token,
 			ExpiresAt:   samlTok.ExpiresAt,
 			UserID:      samlTok.UserID,
-		}
+		}, nil
 	case oauthProviders[input.authProvider]:
 		tokenPtr, err := oauthAuth(client, input, selectedProvider, useV1Public)
 		if err != nil {
-			return nil, err
+			return loginToken{}, err
 		}
-		token = *tokenPtr
+		return *tokenPtr, nil
 	default:
-		customPrint(fmt.Sprintf("Enter credentials for %s \n", input.authProvider))
-		tok, err := basicAuth(client, input, useV1Public)
-		if err != nil {
-			return nil, err
+		if input.nonInteractive {
+			return loginToken{}, errNonInteractive
 		}
-		token = tok
+		customPrint(fmt.Sprintf("Enter credentials for %s \n", input.authProvider))
+		return basicAuth(client, input, useV1Public)
+	}
+}
+
+func loginAndGenerateCred(ctx context.Context, client *http.Client, input *LoginInput) (*config.ExecCredential, error) {
+	token, err := authenticate(ctx, client, input)
+	if err != nil {
+		return nil, err
 	}
+	return newExecCredential(token)
+}
 
+// newExecCredential returns the credential holding the token issued by Rancher.
+func newExecCredential(token loginToken) (*config.ExecCredential, error) {
 	cred := &config.ExecCredential{
 		TypeMeta: config.TypeMeta{
-			Kind:       "ExecCredential",
-			APIVersion: "client.authentication.k8s.io/v1beta1",
+			Kind:       execCredentialKind,
+			APIVersion: execCredentialV1Beta1,
 		},
 		Status: &config.ExecCredentialStatus{},
 	}
@@ -405,10 +497,7 @@ func basicAuth(client *http.Client, input *LoginInput, useV1Public bool) (loginT
 		return loginToken{}, err
 	}
 
-	responseType := "kubeconfig"
-	if input.clusterID != "" {
-		responseType = fmt.Sprintf("%s_%s", responseType, input.clusterID)
-	}
+	responseType := input.loginResponseType()
 
 	reqBody, err := json.Marshal(map[string]any{
 		"type":         input.authProvider,
@@ -447,139 +536,6 @@ func basicAuth(client *http.Client, input *LoginInput, useV1Public bool) (loginT
 	return token, nil
 }
 
-func samlAuth(client *http.Client, input *LoginInput, useV1Public bool) (managementClient.Token, error) {
-	token := managementClient.Token{}
-
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return token, fmt.Errorf("error generating key: %w", err)
-	}
-
-	publicKey := privateKey.PublicKey
-	marshalKey, err := json.Marshal(publicKey)
-	if err != nil {
-		return token, fmt.Errorf("error marshaling public key: %w", err)
-	}
-	encodedKey := base64.StdEncoding.EncodeToString(marshalKey)
-
-	id, err := generateKey()
-	if err != nil {
-		return token, fmt.Errorf("error generating request id: %w", err)
-	}
-
-	responseType := "kubeconfig"
-	if input.clusterID != "" {
-		responseType = fmt.Sprintf("%s_%s", responseType, input.clusterID)
-	}
-
-	tokenURL := fmt.Sprintf(authTokenURL, input.server, id)
-	if !useV1Public {
-		tokenURL = fmt.Sprintf(authTokenURLv3, input.server, id)
-	}
-
-	getReq, err := http.NewRequest(http.MethodGet, tokenURL, bytes.NewBuffer(nil))
-	if err != nil {
-		return token, fmt.Errorf("error creating get token request: %w", err)
-	}
-	getReq.Header.Set("content-type", "application/json")
-	getReq.Header.Set("accept", "application/json")
-
-	deleteReq, err := http.NewRequest(http.MethodDelete, tokenURL, bytes.NewBuffer(nil))
-	if err != nil {
-		return token, fmt.Errorf("error creating delete token request: %w", err)
-	}
-	deleteReq.Header.Set("content-type", "application/json")
-	deleteReq.Header.Set("accept", "application/json")
-
-	loginURL, err := url.Parse(input.server + "/dashboard/auth/login")
-	if err != nil {
-		return token, fmt.Errorf("error parsing login url: %w", err)
-	}
-
-	q := url.Values{}
-	q.Set("cli", "true")
-	q.Set("requestId", id)
-	q.Set("publicKey", encodedKey)
-	q.Set("responseType", responseType)
-	loginURL.RawQuery = q.Encode()
-
-	customPrint(fmt.Sprintf("\nLogin Request Id: %s\n", id))
-	customPrint(fmt.Sprintf("\nLogin to Rancher Server at %s \n", loginURL))
-
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
-	defer signal.Stop(interrupt)
-
-	// Timeout for the login flow.
-	timeout := time.NewTimer(15 * time.Minute)
-	defer timeout.Stop()
-	// Poll for the auth token every 10 seconds.
-	poll := time.NewTicker(10 * time.Second)
-	defer poll.Stop()
-
-loop:
-	for {
-		select {
-		case <-poll.C:
-			// Fetch the auth token.
-			resp, respBody, err := doRequest(client, getReq)
-			if err != nil {
-				return token, fmt.Errorf("error fetching auth token: %w", err)
-			}
-			switch resp.StatusCode {
-			case http.StatusOK: // Found the token.
-			case http.StatusNotFound: // Token not yet created, continue polling.
-				continue
-			default:
-				return token, fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
-			}
-
-			err = json.Unmarshal(respBody, &token)
-			if err != nil {
-				return token, fmt.Errorf("error unmarshaling auth token response: %w", err)
-			}
-			if token.Token == "" {
-				continue
-			}
-			decoded, err := base64.StdEncoding.DecodeString(token.Token)
-			if err != nil {
-				return token, fmt.Errorf("error decoding auth token: %w", err)
-			}
-			decryptedBytes, err := privateKey.Decrypt(nil, decoded, &rsa.OAEPOptions{Hash: crypto.SHA256})
-			if err != nil {
-				return token, fmt.Errorf("error decrypting auth token: %w", err)
-			}
-			token.Token = string(decryptedBytes)
-
-			// Delete the auth token.
-			resp, _, err = doRequest(client, deleteReq)
-			if err == nil {
-				switch resp.StatusCode {
-				case http.StatusOK, http.StatusNoContent, http.StatusNotFound: // Do nothing.
-				default:
-					err = fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
-				}
-			}
-			if err != nil {
-				// Log the error and move on.
-				customPrint(fmt.Errorf("error deleting auth token: %s", err))
-			}
-
-			return token, nil
-
-		case <-timeout.C:
-			customPrint("timed out waiting for the auth token")
-			break loop
-
-		case <-interrupt:
-			customPrint("interrupted waiting for the auth token")
-			break loop
-		}
-	}
-
-	return token, nil
-}
-
 type TypedProvider interface {
 	GetType() string
 }
@@ -635,6 +591,14 @@ func getAuthProviders(client *http.Client, server string, useV1Public bool) ([]T
 			switch providerType {
 			case "azureADProvider":
 				typedProvider = &apiv3.AzureADProvider{}
+			case "genericOIDCProvider":
+				typedProvider = &apiv3.GenericOIDCProvider{}
+			case "keyCloakOIDCProvider":
+				typedProvider = &apiv3.KeyCloakOIDCProvider{}
+			case "githubProvider":
+				typedProvider = &apiv3.GithubProvider{}
+			case "googleOAuthProvider":
+				typedProvider = &apiv3.GoogleOAuthProvider{}
 			case "localProvider":
 				typedProvider = &apiv3.LocalProvider{}
 			default:
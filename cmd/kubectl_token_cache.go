@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/urfave/cli/v3"
+)
+
+// CachedCredentialData is a kube credential cached by 'rancher token'.
+type CachedCredentialData struct {
+	Server    string     `json:"server"`
+	Key       string     `json:"key"`
+	Type      string     `json:"type"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Expires   string     `json:"-"`
+	TTL       string     `json:"ttl"`
+}
+
+func tokenLsCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "ls",
+		Usage:  "List the tokens cached for kubectl login",
+		Action: tokenLs,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"o"},
+				Usage:   "'json', 'yaml' or custom format: '{{.Server}} {{.Key}} {{.TTL}}'",
+			},
+		},
+	}
+}
+
+func tokenPruneCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "prune",
+		Usage:  "Delete the expired tokens cached for kubectl login of all servers",
+		Action: tokenPrune,
+	}
+}
+
+func tokenLs(ctx context.Context, cmd *cli.Command) error {
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	creds, err := cf.LoadCredentials()
+	if err != nil {
+		return err
+	}
+	return listCachedCredentials(cmd.Root().Writer, creds, cmd.String("format"), time.Now())
+}
+
+// listCachedCredentials writes the kube credentials cached for every server.
+func listCachedCredentials(out io.Writer, creds *config.CredentialStore, format string, now time.Time) error {
+	writer := NewTableWriterWithConfig([][]string{
+		{"SERVER", "Server"},
+		{"KEY", "Key"},
+		{"TYPE", "Type"},
+		{"EXPIRES", "Expires"},
+		{"TTL", "TTL"},
+	}, &TableWriterConfig{
+		Writer: out,
+		Format: format,
+	})
+	defer writer.Close()
+
+	for _, data := range cachedCredentials(creds, now) {
+		writer.Write(data)
+	}
+	return writer.Err()
+}
+
+func cachedCredentials(creds *config.CredentialStore, now time.Time) []*CachedCredentialData {
+	var credentials []*CachedCredentialData
+	for _, server := range slices.Sorted(maps.Keys(creds.Servers)) {
+		for _, key := range slices.Sorted(maps.Keys(creds.Servers[server])) {
+			cred := creds.Servers[server][key]
+			if cred == nil || cred.Status == nil {
+				continue
+			}
+
+			data := &CachedCredentialData{
+				Server:  server,
+				Key:     key,
+				Type:    "token",
+				Expires: "never",
+				TTL:     "-",
+			}
+			if cred.Status.ClientCertificateData != "" {
+				data.Type = "certificate"
+			}
+			if ts := cred.Status.ExpirationTimestamp; ts != nil {
+				expiresAt := ts.Time
+				data.ExpiresAt = &expiresAt
+				data.Expires = expiresAt.Local().Format(time.RFC3339)
+				data.TTL = "expired"
+				if ttl := expiresAt.Sub(now); ttl > 0 {
+					data.TTL = ttl.Round(time.Second).String()
+				}
+			}
+			credentials = append(credentials, data)
+		}
+	}
+	return credentials
+}
+
+func tokenPrune(ctx context.Context, cmd *cli.Command) error {
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	var pruned []string
+	err = cf.UpdateCredentials(func(s *config.CredentialStore) error {
+		pruned = pruneCachedCredentials(s, time.Now())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(pruned) == 0 {
+		customPrint("there are no expired cached tokens")
+		return nil
+	}
+	for _, key := range pruned {
+		customPrint(fmt.Sprintf("removed [%s]", key))
+	}
+	return nil
+}
+
+// pruneCachedCredentials deletes the expired kube credentials of all servers,
+// and returns them as <server>/<key>.
+func pruneCachedCredentials(creds *config.CredentialStore, now time.Time) []string {
+	var pruned []string
+	for _, server := range slices.Sorted(maps.Keys(creds.Servers)) {
+		for _, key := range slices.Sorted(maps.Keys(creds.Servers[server])) {
+			cred := creds.Servers[server][key]
+			if cred != nil && cred.Status != nil {
+				ts := cred.Status.ExpirationTimestamp
+				if ts == nil || ts.After(now) {
+					continue
+				}
+			}
+			creds.Delete(server, key)
+			pruned = append(pruned, server+"/"+key)
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCachedCredentialsStore(now time.Time) *config.CredentialStore {
+	return &config.CredentialStore{
+		Servers: map[string]map[string]*config.ExecCredential{
+			"https://rancher.example.com": {
+				"u-abcde_c-12345": {Status: &config.ExecCredentialStatus{
+					Token:               "kubeconfig-u-abcde:secret",
+					ExpirationTimestamp: &config.Time{Time: now.Add(90 * time.Minute)},
+				}},
+				"u-abcde_c-12345_cert": {Status: &config.ExecCredentialStatus{
+					ClientCertificateData: "cert",
+					ClientKeyData:         "key",
+					ExpirationTimestamp:   &config.Time{Time: now.Add(-time.Minute)},
+				}},
+				"u-abcde_": {Status: &config.ExecCredentialStatus{
+					Token: "kubeconfig-u-abcde:secret",
+				}},
+			},
+			"https://staging.example.com": {
+				"u-fghij_c-67890": {Status: &config.ExecCredentialStatus{
+					Token:               "kubeconfig-u-fghij:secret",
+					ExpirationTimestamp: &config.Time{Time: now.Add(-time.Hour)},
+				}},
+				"u-fghij_c-empty": nil,
+			},
+		},
+	}
+}
+
+func TestListCachedCredentials(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	creds := newCachedCredentialsStore(now)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, listCachedCredentials(out, creds, "{{.Server}} {{.Key}} {{.Type}} {{.TTL}}", now))
+	assert.Equal(t, `https://rancher.example.com u-abcde_ token -
+https://rancher.example.com u-abcde_c-12345 token 1h30m0s
+https://rancher.example.com u-abcde_c-12345_cert certificate expired
+https://staging.example.com u-fghij_c-67890 token expired
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, listCachedCredentials(out, creds, "json", now))
+	assert.Contains(t, out.String(), `{"server":"https://rancher.example.com","key":"u-abcde_c-12345","type":"token","expiresAt":"2030-01-02T04:34:05Z","ttl":"1h30m0s"}`)
+	assert.NotContains(t, out.String(), "kubeconfig-u-abcde:secret")
+}
+
+func TestPruneCachedCredentials(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	creds := newCachedCredentialsStore(now)
+
+	pruned := pruneCachedCredentials(creds, now)
+	assert.Equal(t, []string{
+		"https://rancher.example.com/u-abcde_c-12345_cert",
+		"https://staging.example.com/u-fghij_c-67890",
+		"https://staging.example.com/u-fghij_c-empty",
+	}, pruned)
+	assert.Len(t, creds.Servers["https://rancher.example.com"], 2)
+	assert.NotContains(t, creds.Servers, "https://staging.example.com")
+}
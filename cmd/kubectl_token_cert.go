@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	csrURL                    = "%s/k8s/clusters/%s/apis/certificates.k8s.io/v1/certificatesigningrequests"
+	csrSignerName             = "kubernetes.io/kube-apiserver-client"
+	csrPollInterval           = 2 * time.Second
+	defaultCSRApprovalTimeout = 2 * time.Minute // waited for in a terminal when the user can't approve the CSR.
+	clientCertCredSuffix      = "_cert"
+	defaultClientCertTTL      = 24 * time.Hour
+	minClientCertTTL          = 10 * time.Minute // the minimum expirationSeconds accepted by Kubernetes.
+)
+
+// certificateSigningRequest holds the fields of a certificates.k8s.io/v1
+// CertificateSigningRequest used by the CLI.
+type certificateSigningRequest struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   map[string]any `json:"metadata"`
+	Spec       struct {
+		Request           []byte   `json:"request"`
+		SignerName        string   `json:"signerName"`
+		Usages            []string `json:"usages"`
+		ExpirationSeconds *int32   `json:"expirationSeconds,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []csrCondition `json:"conditions,omitempty"`
+		// Certificate is the PEM encoded certificate issued by the signer.
+		Certificate []byte `json:"certificate,omitempty"`
+	} `json:"status"`
+}
+
+type csrCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// clientCertCredential generates a key pair and has its certificate signed
+// through the CertificateSigningRequest API of the cluster, proxied by Rancher
+// and authenticated with bearerToken. The CSR is approved right away when the
+// user is allowed to. Otherwise, when interactive, it waits up to
+// approvalTimeout for a cluster admin to approve it, and fails right away when
+// run by kubectl without a terminal, as kubectl would hang meanwhile.
+// The certificate is issued for the user ID, which is the name Rancher uses
+// for the user in the RBAC of the cluster, so it's only accepted by the
+// authorized cluster endpoint of the cluster.
+func clientCertCredential(ctx context.Context, client *http.Client, input *LoginInput, bearerToken string, ttl, approvalTimeout time.Duration) (*config.ExecCredential, error) {
+	if ttl < minClientCertTTL {
+		return nil, fmt.Errorf("the client certificate TTL must be at least %s", minClientCertTTL)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: input.userID},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate request: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling key: %w", err)
+	}
+
+	csr := &certificateSigningRequest{
+		APIVersion: "certificates.k8s.io/v1",
+		Kind:       "CertificateSigningRequest",
+		Metadata:   map[string]any{"generateName": "rancher-cli-"},
+	}
+	expirationSeconds := int32(ttl / time.Second)
+	csr.Spec.Request = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	csr.Spec.SignerName = csrSignerName
+	csr.Spec.Usages = []string{"client auth"}
+	csr.Spec.ExpirationSeconds = &expirationSeconds
+
+	baseURL := fmt.Sprintf(csrURL, input.server, input.clusterID)
+	csr, err = doCSRRequest(client, http.MethodPost, baseURL, bearerToken, csr, http.StatusCreated)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate signing request: %w", err)
+	}
+	name, _ := csr.Metadata["name"].(string)
+	if name == "" {
+		return nil, errors.New("error creating certificate signing request: no name was returned by the server")
+	}
+
+	csr.Status.Conditions = append(csr.Status.Conditions, csrCondition{
+		Type:    "Approved",
+		Status:  "True",
+		Reason:  "RancherCLIApprove",
+		Message: "Approved by the Rancher CLI",
+	})
+	if _, err := doCSRRequest(client, http.MethodPut, baseURL+"/"+name+"/approval", bearerToken, csr, http.StatusOK); err != nil {
+		if !isUnauthorized(err) {
+			return nil, fmt.Errorf("error approving certificate signing request %s: %w", name, err)
+		}
+		if input.nonInteractive || approvalTimeout <= 0 {
+			deleteCSR(client, baseURL+"/"+name, bearerToken)
+			return nil, fmt.Errorf("you aren't allowed to approve the certificate signing request of the client certificate, "+
+				"run `rancher token --client-cert` in a terminal to wait for a cluster admin to approve it: %w", err)
+		}
+		customPrint(fmt.Sprintf("Waiting %s for a cluster admin to approve the certificate signing request: kubectl certificate approve %s", approvalTimeout, name))
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, approvalTimeout)
+	defer cancel()
+	certPEM, err := waitForCertificate(waitCtx, client, baseURL+"/"+name, bearerToken)
+	if err != nil {
+		deleteCSR(client, baseURL+"/"+name, bearerToken)
+		return nil, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, errors.New("no cert was issued")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the issued certificate: %w", err)
+	}
+
+	return &config.ExecCredential{
+		TypeMeta: config.TypeMeta{
+			Kind:       execCredentialKind,
+			APIVersion: execCredentialV1Beta1,
+		},
+		Status: &config.ExecCredentialStatus{
+			ClientCertificateData: string(certPEM),
+			ClientKeyData:         string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+			ExpirationTimestamp:   &config.Time{Time: cert.NotAfter},
+		},
+	}, nil
+}
+
+// waitForCertificate polls the CSR until the certificate is issued, or the
+// CSR is denied or fails.
+func waitForCertificate(ctx context.Context, client *http.Client, url, bearerToken string) ([]byte, error) {
+	poll := time.NewTicker(csrPollInterval)
+	defer poll.Stop()
+
+	for {
+		csr, err := doCSRRequest(client, http.MethodGet, url, bearerToken, nil, http.StatusOK)
+		if err != nil {
+			return nil, fmt.Errorf("error getting certificate signing request: %w", err)
+		}
+		if len(csr.Status.Certificate) > 0 {
+			return csr.Status.Certificate, nil
+		}
+		for _, condition := range csr.Status.Conditions {
+			if (condition.Type == "Denied" || condition.Type == "Failed") && condition.Status == "True" {
+				return nil, fmt.Errorf("certificate signing request %s: %s %s", condition.Type, condition.Reason, condition.Message)
+			}
+		}
+
+		select {
+		case <-poll.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for the certificate: %w", ctx.Err())
+		}
+	}
+}
+
+// deleteCSR deletes the CSR at url, which won't be used, so that it isn't left
+// for a cluster admin to approve.
+func deleteCSR(client *http.Client, url, bearerToken string) {
+	resp, body, err := doBearerRequest(client, http.MethodDelete, url, bearerToken, nil)
+	if err == nil && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		err = newAPIError(resp, url, body)
+	}
+	if err != nil {
+		logrus.Debugf("Unable to delete the certificate signing request %s: %s", url, err)
+	}
+}
+
+// doCSRRequest sends csr, if any, and returns the CSR of the response. Errors
+// are *clientbase.APIError, like those of getExtToken.
+func doCSRRequest(client *http.Client, method, url, bearerToken string, csr *certificateSigningRequest, expectedStatus int) (*certificateSigningRequest, error) {
+	var body []byte
+	if csr != nil {
+		var err error
+		if body, err = json.Marshal(csr); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, respBody, err := doBearerRequest(client, method, url, bearerToken, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expectedStatus {
+		return nil, newAPIError(resp, url, respBody)
+	}
+
+	out := &certificateSigningRequest{}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return nil, fmt.Errorf("error unmarshaling certificate signing request: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signCSR signs the PEM encoded certificate request with a throwaway CA.
+func signCSR(t *testing.T, request []byte, ttl time.Duration) []byte {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kube-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour * 24 * 365),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	block, _ := pem.Decode(request)
+	require.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, csr.CheckSignature())
+
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(ttl).Truncate(time.Second),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, cert, ca, csr.PublicKey, caKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestClientCertCredential(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		approvalStatus int
+		denied         bool
+		nonInteractive bool
+		expectedErr    string
+		expectDeleted  bool
+	}{
+		{
+			name:           "approved by the user",
+			approvalStatus: http.StatusOK,
+		},
+		{
+			name:           "denied by an admin",
+			approvalStatus: http.StatusForbidden,
+			denied:         true,
+			expectedErr:    "certificate signing request Denied: NotAllowed",
+			expectDeleted:  true,
+		},
+		{
+			name:           "not allowed to approve, non-interactive",
+			approvalStatus: http.StatusForbidden,
+			nonInteractive: true,
+			expectedErr:    "you aren't allowed to approve the certificate signing request",
+			expectDeleted:  true,
+		},
+		{
+			name:           "approval error",
+			approvalStatus: http.StatusInternalServerError,
+			expectedErr:    "error approving certificate signing request rancher-cli-abcde",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const basePath = "/k8s/clusters/c-m-12345/apis/certificates.k8s.io/v1/certificatesigningrequests"
+			var created certificateSigningRequest
+			var deleted bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "Bearer kubeconfig-u-abcde:secret", r.Header.Get("Authorization"))
+
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == basePath:
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+					assert.Equal(t, csrSignerName, created.Spec.SignerName)
+					assert.Equal(t, []string{"client auth"}, created.Spec.Usages)
+					require.NotNil(t, created.Spec.ExpirationSeconds)
+					assert.Equal(t, int32(3600), *created.Spec.ExpirationSeconds)
+					created.Metadata["name"] = "rancher-cli-abcde"
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(created)
+				case r.Method == http.MethodPut && r.URL.Path == basePath+"/rancher-cli-abcde/approval":
+					w.WriteHeader(tt.approvalStatus)
+					var approved certificateSigningRequest
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&approved))
+					require.Len(t, approved.Status.Conditions, 1)
+					assert.Equal(t, "Approved", approved.Status.Conditions[0].Type)
+					_ = json.NewEncoder(w).Encode(approved)
+				case r.Method == http.MethodGet && r.URL.Path == basePath+"/rancher-cli-abcde":
+					issued := created
+					if tt.denied {
+						issued.Status.Conditions = []csrCondition{{Type: "Denied", Status: "True", Reason: "NotAllowed"}}
+					} else {
+						issued.Status.Certificate = signCSR(t, created.Spec.Request, time.Hour)
+					}
+					_ = json.NewEncoder(w).Encode(issued)
+				case r.Method == http.MethodDelete && r.URL.Path == basePath+"/rancher-cli-abcde":
+					deleted = true
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+			}))
+			defer server.Close()
+
+			input := &LoginInput{server: server.URL, userID: "u-abcde", clusterID: "c-m-12345", nonInteractive: tt.nonInteractive}
+			cred, err := clientCertCredential(context.Background(), server.Client(), input, "kubeconfig-u-abcde:secret", time.Hour, time.Minute)
+			assert.Equal(t, tt.expectDeleted, deleted)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			keyPair, err := tls.X509KeyPair([]byte(cred.Status.ClientCertificateData), []byte(cred.Status.ClientKeyData))
+			require.NoError(t, err)
+			assert.Equal(t, "u-abcde", keyPair.Leaf.Subject.CommonName)
+			require.NotNil(t, cred.Status.ExpirationTimestamp)
+			assert.True(t, keyPair.Leaf.NotAfter.Equal(cred.Status.ExpirationTimestamp.Time))
+			assert.Empty(t, cred.Status.Token)
+		})
+	}
+}
+
+func TestClientCertCredentialTTL(t *testing.T) {
+	t.Parallel()
+
+	_, err := clientCertCredential(context.Background(), http.DefaultClient, &LoginInput{}, "", time.Minute, time.Minute)
+	assert.EqualError(t, err, "the client certificate TTL must be at least 10m0s")
+}
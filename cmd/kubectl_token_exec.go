@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rancher/cli/config"
+)
+
+const (
+	execInfoEnv           = "KUBERNETES_EXEC_INFO"
+	execCredentialKind    = "ExecCredential"
+	execCredentialV1Beta1 = "client.authentication.k8s.io/v1beta1"
+	execCredentialV1      = "client.authentication.k8s.io/v1"
+)
+
+var errNonInteractive = errors.New("login required but kubectl runs the credential plugin non-interactively, run 'rancher token' in a terminal first")
+
+// readExecInfo returns the ExecCredential passed by kubectl in
+// KUBERNETES_EXEC_INFO, or nil when it's not set.
+func readExecInfo() (*config.ExecCredential, error) {
+	content := os.Getenv(execInfoEnv)
+	if content == "" {
+		return nil, nil
+	}
+
+	var info config.ExecCredential
+	if err := json.Unmarshal([]byte(content), &info); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", execInfoEnv, err)
+	}
+	switch info.APIVersion {
+	case execCredentialV1, execCredentialV1Beta1:
+	default:
+		return nil, fmt.Errorf("unsupported %s apiVersion %q", execInfoEnv, info.APIVersion)
+	}
+	return &info, nil
+}
+
+// execInfoInteractive reports whether the user can be prompted, which is the
+// case when kubectl passes stdin to the plugin or when run outside kubectl.
+func execInfoInteractive(info *config.ExecCredential) bool {
+	return info == nil || info.Spec.Interactive
+}
+
+// clusterIDFromExecInfo infers the cluster ID from the cluster info passed by
+// kubectl when provideClusterInfo is set: the clusterID of the exec extension
+// of the cluster, or the ID in the URL of the clusters proxied by Rancher.
+func clusterIDFromExecInfo(info *config.ExecCredential) string {
+	if info == nil || info.Spec.Cluster == nil {
+		return ""
+	}
+
+	if len(info.Spec.Cluster.Config) > 0 {
+		var extension struct {
+			ClusterID string `json:"clusterID"`
+		}
+		if err := json.Unmarshal(info.Spec.Cluster.Config, &extension); err == nil && extension.ClusterID != "" {
+			return extension.ClusterID
+		}
+	}
+
+	u, err := url.Parse(info.Spec.Cluster.Server)
+	if err != nil {
+		return ""
+	}
+	_, clusterPath, ok := strings.Cut(u.Path, "/k8s/clusters/")
+	if !ok {
+		return ""
+	}
+	clusterID, _, _ := strings.Cut(clusterPath, "/")
+	return clusterID
+}
+
+// writeExecCredential writes cred in the apiVersion requested by kubectl,
+// v1beta1 when it's not known.
+func writeExecCredential(w io.Writer, cred *config.ExecCredential, info *config.ExecCredential) error {
+	apiVersion := execCredentialV1Beta1
+	if info != nil {
+		apiVersion = info.APIVersion
+	}
+
+	out := config.ExecCredential{
+		TypeMeta: config.TypeMeta{
+			Kind:       execCredentialKind,
+			APIVersion: apiVersion,
+		},
+		Status: cred.Status,
+	}
+	return json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadExecInfo(t *testing.T) {
+	tests := []struct {
+		name                string
+		execInfo            string
+		expectedAPIVersion  string
+		expectedInteractive bool
+		expectedClusterID   string
+		expectedErr         string
+	}{
+		{
+			name:                "not run by kubectl",
+			expectedInteractive: true,
+		},
+		{
+			name:               "v1 non-interactive",
+			execInfo:           `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":false}}`,
+			expectedAPIVersion: execCredentialV1,
+		},
+		{
+			name:                "v1beta1 interactive with cluster info",
+			execInfo:            `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","spec":{"interactive":true,"cluster":{"server":"https://rancher.example.com/k8s/clusters/c-m-abcde"}}}`,
+			expectedAPIVersion:  execCredentialV1Beta1,
+			expectedInteractive: true,
+			expectedClusterID:   "c-m-abcde",
+		},
+		{
+			name:               "cluster ID from the exec extension",
+			execInfo:           `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"cluster":{"server":"https://10.0.0.1:6443","config":{"clusterID":"c-m-fghij"}}}}`,
+			expectedAPIVersion: execCredentialV1,
+			expectedClusterID:  "c-m-fghij",
+		},
+		{
+			name:        "unsupported version",
+			execInfo:    `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1alpha1"}`,
+			expectedErr: `unsupported KUBERNETES_EXEC_INFO apiVersion "client.authentication.k8s.io/v1alpha1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(execInfoEnv, tt.execInfo)
+
+			info, err := readExecInfo()
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expectedAPIVersion != "" {
+				require.NotNil(t, info)
+				assert.Equal(t, tt.expectedAPIVersion, info.APIVersion)
+			} else {
+				assert.Nil(t, info)
+			}
+			assert.Equal(t, tt.expectedInteractive, execInfoInteractive(info))
+			assert.Equal(t, tt.expectedClusterID, clusterIDFromExecInfo(info))
+		})
+	}
+}
+
+func TestWriteExecCredential(t *testing.T) {
+	t.Parallel()
+
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	cred := &config.ExecCredential{
+		TypeMeta: config.TypeMeta{Kind: execCredentialKind, APIVersion: execCredentialV1Beta1},
+		Status: &config.ExecCredentialStatus{
+			Token:               "kubeconfig-u-abcde:secret",
+			ExpirationTimestamp: &config.Time{Time: expiration},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeExecCredential(&buf, cred, nil))
+	assert.JSONEq(t, `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","spec":{},"status":{"token":"kubeconfig-u-abcde:secret","expirationTimestamp":"2030-01-02T03:04:05Z"}}`, buf.String())
+
+	buf.Reset()
+	info := &config.ExecCredential{
+		TypeMeta: config.TypeMeta{Kind: execCredentialKind, APIVersion: execCredentialV1},
+		Spec:     config.ExecCredentialSpec{Interactive: true},
+	}
+	require.NoError(t, writeExecCredential(&buf, cred, info))
+	assert.JSONEq(t, `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{},"status":{"token":"kubeconfig-u-abcde:secret","expirationTimestamp":"2030-01-02T03:04:05Z"}}`, buf.String())
+}
+
+func TestAuthenticateNonInteractive(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1-public/authproviders":
+			_, _ = w.Write([]byte(`{"data":[{"type":"localProvider"},{"type":"openLdapProvider"}]}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	_, err := authenticate(context.Background(), server.Client(), &LoginInput{server: server.URL, nonInteractive: true})
+	assert.ErrorIs(t, err, errNonInteractive)
+
+	_, err = authenticate(context.Background(), server.Client(), &LoginInput{server: server.URL, authProvider: "localProvider", nonInteractive: true})
+	assert.ErrorIs(t, err, errNonInteractive)
+}
@@ -25,6 +25,9 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// oidcDefaultScopes are requested from OIDC providers that don't configure scopes.
+var oidcDefaultScopes = []string{"openid", "profile", "email"}
+
 const (
 	oauthCodeFlowTimeout          = 5 * time.Minute
 	oauthCodeExchangeTimeout      = 30 * time.Second
@@ -275,6 +278,9 @@ func oauthDeviceCodeAuth(client *http.Client, input *LoginInput, provider TypedP
 	if err != nil {
 		return nil, fmt.Errorf("failed to create oauth config: %w", err)
 	}
+	if oauthConfig.Endpoint.DeviceAuthURL == "" {
+		return nil, fmt.Errorf("provider %s doesn't support the %s flow, use --auth-flow %s", provider.GetType(), deviceAuthFlow, authCodeFlow)
+	}
 
 	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client) // Set the custom HTTP client.
 
@@ -303,18 +309,37 @@ func oauthDeviceCodeAuth(client *http.Client, input *LoginInput, provider TypedP
 }
 
 func newOauthConfig(provider TypedProvider) (*oauth2.Config, error) {
-	var oauthProvider apiv3.OAuthProvider
-
+	var (
+		oauthProvider apiv3.OAuthProvider
+		scopes        []string
+	)
 	switch p := provider.(type) {
 	case *apiv3.AzureADProvider:
 		oauthProvider = p.OAuthProvider
+	case *apiv3.GenericOIDCProvider:
+		oauthProvider = p.OAuthProvider
+		scopes = oidcDefaultScopes
+	case *apiv3.KeyCloakOIDCProvider:
+		oauthProvider = p.OAuthProvider
+		scopes = oidcDefaultScopes
+	case *apiv3.GithubProvider:
+		oauthProvider = p.OAuthProvider
+	case *apiv3.GoogleOAuthProvider:
+		oauthProvider = p.OAuthProvider
+		scopes = oidcDefaultScopes
 	default:
 		return nil, fmt.Errorf("provider %s is not a supported OAuth provider", provider.GetType())
 	}
+	if oauthProvider.ClientID == "" {
+		return nil, fmt.Errorf("provider %s is not configured for the CLI, it has no client ID", provider.GetType())
+	}
+	if len(oauthProvider.Scopes) > 0 {
+		scopes = oauthProvider.Scopes
+	}
 
 	return &oauth2.Config{
 		ClientID: oauthProvider.ClientID,
-		Scopes:   oauthProvider.Scopes,
+		Scopes:   scopes,
 		Endpoint: oauth2.Endpoint{
 			AuthURL:       oauthProvider.AuthURL,
 			DeviceAuthURL: oauthProvider.DeviceAuthURL,
@@ -331,16 +356,21 @@ func rancherLogin(client *http.Client, input *LoginInput, oauthToken *oauth2.Tok
 		reqURL = fmt.Sprintf(loginURLv3, input.server, input.authProvider, providerName)
 	}
 
-	responseType := "kubeconfig"
-	if input.clusterID != "" {
-		responseType = fmt.Sprintf("%s_%s", responseType, input.clusterID)
-	}
+	responseType := input.loginResponseType()
 
-	reqBody, err := json.Marshal(map[string]any{
+	body := map[string]any{
 		"type":         input.authProvider,
 		"responseType": responseType,
-		"id_token":     oauthToken.Extra("id_token"),
-	})
+	}
+	if idToken := oauthToken.Extra("id_token"); idToken != nil {
+		body["id_token"] = idToken
+	} else {
+		// OAuth providers like GitHub don't issue an id_token, Rancher
+		// identifies the user with the access token instead.
+		body["access_token"] = oauthToken.AccessToken
+	}
+
+	reqBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
@@ -363,6 +393,7 @@ func rancherLogin(client *http.Client, input *LoginInput, oauthToken *oauth2.Tok
 	if err != nil {
 		return nil, err
 	}
+	input.oauthToken = oauthToken
 
 	return &token, nil
 }
@@ -536,3 +536,126 @@ func TestOpenBrowserInvalidURL(t *testing.T) {
 		})
 	}
 }
+
+func TestNewOauthConfig(t *testing.T) {
+	t.Parallel()
+
+	oauthProvider := apiv3.OAuthProvider{
+		ClientID: "test-client-id",
+		OAuthEndpoint: apiv3.OAuthEndpoint{
+			AuthURL:       "https://idp.example.com/auth",
+			DeviceAuthURL: "https://idp.example.com/device",
+			TokenURL:      "https://idp.example.com/token",
+		},
+	}
+	withScopes := oauthProvider
+	withScopes.Scopes = []string{"openid", "groups"}
+
+	tests := []struct {
+		name           string
+		provider       TypedProvider
+		expectedScopes []string
+		expectedErr    string
+	}{
+		{
+			name: "generic OIDC with default scopes",
+			provider: &apiv3.GenericOIDCProvider{OIDCProvider: apiv3.OIDCProvider{
+				AuthProvider:  apiv3.AuthProvider{Type: "genericOIDCProvider"},
+				OAuthProvider: oauthProvider,
+			}},
+			expectedScopes: []string{"openid", "profile", "email"},
+		},
+		{
+			name: "keycloak OIDC with configured scopes",
+			provider: &apiv3.KeyCloakOIDCProvider{OIDCProvider: apiv3.OIDCProvider{
+				AuthProvider:  apiv3.AuthProvider{Type: "keyCloakOIDCProvider"},
+				OAuthProvider: withScopes,
+			}},
+			expectedScopes: []string{"openid", "groups"},
+		},
+		{
+			name: "github",
+			provider: &apiv3.GithubProvider{
+				AuthProvider:  apiv3.AuthProvider{Type: "githubProvider"},
+				OAuthProvider: oauthProvider,
+			},
+		},
+		{
+			name: "google",
+			provider: &apiv3.GoogleOAuthProvider{
+				AuthProvider:  apiv3.AuthProvider{Type: "googleOAuthProvider"},
+				OAuthProvider: oauthProvider,
+			},
+			expectedScopes: []string{"openid", "profile", "email"},
+		},
+		{
+			name: "no client ID",
+			provider: &apiv3.GithubProvider{
+				AuthProvider: apiv3.AuthProvider{Type: "githubProvider"},
+			},
+			expectedErr: "provider githubProvider is not configured for the CLI, it has no client ID",
+		},
+		{
+			name:        "unsupported provider",
+			provider:    &apiv3.LocalProvider{AuthProvider: apiv3.AuthProvider{Type: "localProvider"}},
+			expectedErr: "provider localProvider is not a supported OAuth provider",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			oauthConfig, err := newOauthConfig(tt.provider)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "test-client-id", oauthConfig.ClientID)
+			assert.Equal(t, tt.expectedScopes, oauthConfig.Scopes)
+			assert.Equal(t, oauthProvider.AuthURL, oauthConfig.Endpoint.AuthURL)
+			assert.Equal(t, oauthProvider.DeviceAuthURL, oauthConfig.Endpoint.DeviceAuthURL)
+			assert.Equal(t, oauthProvider.TokenURL, oauthConfig.Endpoint.TokenURL)
+		})
+	}
+}
+
+func TestRancherLoginWithAccessToken(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "githubProvider", body["type"])
+		assert.Equal(t, "test-access-token", body["access_token"])
+		assert.NotContains(t, body, "id_token")
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": "rancher-token-123"}`)
+	}))
+	defer server.Close()
+
+	input := &LoginInput{
+		server:       server.URL,
+		authProvider: "githubProvider",
+	}
+	token, err := rancherLogin(server.Client(), input, &oauth2.Token{AccessToken: "test-access-token"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, "rancher-token-123", token.BearerToken)
+}
+
+func TestOauthDeviceCodeAuthUnsupported(t *testing.T) {
+	t.Parallel()
+
+	provider := &apiv3.GithubProvider{
+		AuthProvider: apiv3.AuthProvider{Type: "githubProvider"},
+		OAuthProvider: apiv3.OAuthProvider{
+			ClientID:      "test-client-id",
+			OAuthEndpoint: apiv3.OAuthEndpoint{AuthURL: "https://github.com/login/oauth/authorize"},
+		},
+	}
+
+	_, err := oauthDeviceCodeAuth(http.DefaultClient, &LoginInput{}, provider, true)
+	assert.EqualError(t, err, "provider githubProvider doesn't support the devicecode flow, use --auth-flow authcode")
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/cli/config"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/oauth2"
+)
+
+// renewCredential renews the kubeconfig token without user interaction, with
+// the refresh token of the OAuth provider the user last logged in with. It
+// returns a nil credential when there is no refresh token for the user. A
+// refresh token rejected by the provider is removed from the config.
+func renewCredential(cmd *cli.Command, client *http.Client, serverConfig *config.ServerConfig, input *LoginInput) (*config.ExecCredential, error) {
+	oauthToken := serverConfig.OAuthTokens[input.userID]
+	if oauthToken == nil || oauthToken.RefreshToken == "" {
+		return nil, nil
+	}
+
+	renewInput := *input
+	renewInput.authProvider = oauthToken.AuthProvider
+	// the provider may rotate the refresh token, the new one is saved before
+	// logging in to Rancher so that it isn't lost if the login fails
+	saveRefreshToken := func(token *oauth2.Token) {
+		if token.RefreshToken == "" || token.RefreshToken == oauthToken.RefreshToken {
+			return
+		}
+		rotatedInput := renewInput
+		rotatedInput.oauthToken = token
+		if err := cacheOAuthToken(cmd, input.userID, &rotatedInput); err != nil {
+			customPrint(fmt.Errorf("CacheRefreshToken: %v", err))
+		}
+	}
+	cred, err := refreshLogin(client, &renewInput, oauthToken.RefreshToken, saveRefreshToken)
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			if err := deleteOAuthToken(cmd, input.userID); err != nil {
+				customPrint(fmt.Errorf("DeleteRefreshToken: %v", err))
+			}
+		}
+		return nil, err
+	}
+
+	*input = renewInput
+	return cred, nil
+}
+
+// refreshLogin gets a new token from the OAuth provider of input with
+// refreshToken, through oauth2.TokenSource, and logs in to Rancher with it.
+// refreshed is called with the new token before logging in.
+func refreshLogin(client *http.Client, input *LoginInput, refreshToken string, refreshed func(*oauth2.Token)) (*config.ExecCredential, error) {
+	authProviders, useV1Public, err := getAuthProviders(client, input.server, true)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := selectAuthProvider(authProviders, input.authProvider)
+	if err != nil {
+		return nil, err
+	}
+	oauthConfig, err := newOauthConfig(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oauthCodeExchangeTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+
+	// without an access token, the token source refreshes the token right away
+	oauthToken, err := oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing the %s token: %w", input.authProvider, err)
+	}
+	refreshed(oauthToken)
+
+	token, err := rancherLogin(client, input, oauthToken, useV1Public)
+	if err != nil {
+		return nil, fmt.Errorf("error during rancher login: %w", err)
+	}
+	return newExecCredential(*token)
+}
+
+// cacheOAuthToken stores the refresh token of the OAuth provider the user
+// logged in with, if any. Refresh tokens are long-lived, so they're only
+// stored when the secrets of the config are kept in a secret store.
+func cacheOAuthToken(cmd *cli.Command, userID string, input *LoginInput) error {
+	if input.oauthToken == nil || input.oauthToken.RefreshToken == "" {
+		return nil
+	}
+
+	var noSecretStore bool
+	err := config.Update(GetConfigPath(cmd), func(cf *config.Config) error {
+		_, sc := cf.LookupServer(cmd.String("server"))
+		if sc == nil {
+			return nil
+		}
+		if cf.SecretBackend == "" {
+			noSecretStore = true
+			delete(sc.OAuthTokens, userID)
+			return nil
+		}
+		if sc.OAuthTokens == nil {
+			sc.OAuthTokens = make(map[string]*config.OAuthToken)
+		}
+		sc.OAuthTokens[userID] = &config.OAuthToken{
+			AuthProvider: input.authProvider,
+			RefreshToken: input.oauthToken.RefreshToken,
+		}
+		return nil
+	})
+	if noSecretStore {
+		customPrint("Run 'rancher config migrate-secrets' to renew the token without logging in again once it expires")
+	}
+	return err
+}
+
+func deleteOAuthToken(cmd *cli.Command, userID string) error {
+	return config.Update(GetConfigPath(cmd), func(cf *config.Config) error {
+		if _, sc := cf.LookupServer(cmd.String("server")); sc != nil {
+			delete(sc.OAuthTokens, userID)
+		}
+		return nil
+	})
+}
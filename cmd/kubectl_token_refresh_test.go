@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/oauth2"
+)
+
+func newRefreshTestServers(t *testing.T, refreshStatus, loginStatus int) *httptest.Server {
+	t.Helper()
+
+	oauthServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/token", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "old-refresh-token", r.PostForm.Get("refresh_token"))
+
+		w.Header().Set("Content-Type", "application/json")
+		if refreshStatus != http.StatusOK {
+			w.WriteHeader(refreshStatus)
+			fmt.Fprint(w, `{"error": "invalid_grant"}`)
+			return
+		}
+		fmt.Fprint(w, `{
+			"access_token": "new-access-token",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"refresh_token": "new-refresh-token",
+			"id_token": "new-id-token"
+		}`)
+	}))
+	t.Cleanup(oauthServer.Close)
+
+	rancherServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1-public/authproviders":
+			fmt.Fprintf(w, `{"data": [
+				{"type": "localProvider"},
+				{"type": "genericOIDCProvider", "clientId": "test-client-id", "tokenUrl": "%s/token"}
+			]}`, oauthServer.URL)
+		case "/v1-public/login":
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "genericOIDCProvider", body["type"])
+			assert.Equal(t, "new-id-token", body["id_token"])
+
+			if loginStatus != http.StatusCreated {
+				w.WriteHeader(loginStatus)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"token": "kubeconfig-u-abcde:renewed"}`)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(rancherServer.Close)
+
+	return rancherServer
+}
+
+func newRefreshTestCommand(t *testing.T, server string, secretBackend string) *cli.Command {
+	t.Helper()
+
+	configDir := t.TempDir()
+	var cliCmd *cli.Command
+	app := &cli.Command{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "server"},
+			&cli.StringFlag{Name: "config"},
+		},
+		Action: func(_ context.Context, c *cli.Command) error {
+			cliCmd = c
+			return nil
+		},
+	}
+	require.NoError(t, app.Run(context.Background(), []string{"test", "--server=" + server, "--config=" + configDir}))
+
+	require.NoError(t, config.Update(GetConfigPath(cliCmd), func(cf *config.Config) error {
+		cf.SecretBackend = secretBackend
+		cf.Servers[server] = &config.ServerConfig{
+			URL: "https://" + server,
+			OAuthTokens: map[string]*config.OAuthToken{
+				"u-abcde": {AuthProvider: "genericOIDCProvider", RefreshToken: "old-refresh-token"},
+			},
+		}
+		return nil
+	}))
+	return cliCmd
+}
+
+func TestRenewCredential(t *testing.T) {
+	t.Setenv("RANCHER_SECRETS_PASSPHRASE", "correct horse")
+
+	tests := []struct {
+		name                 string
+		refreshStatus        int
+		loginStatus          int
+		expectedToken        string
+		expectedErr          string
+		expectedRefreshToken string
+	}{
+		{
+			name:                 "renewed",
+			refreshStatus:        http.StatusOK,
+			loginStatus:          http.StatusCreated,
+			expectedToken:        "kubeconfig-u-abcde:renewed",
+			expectedRefreshToken: "new-refresh-token",
+		},
+		{
+			name:          "refresh token rejected",
+			refreshStatus: http.StatusBadRequest,
+			expectedErr:   "invalid_grant",
+		},
+		{
+			name:                 "rancher login failed",
+			refreshStatus:        http.StatusOK,
+			loginStatus:          http.StatusInternalServerError,
+			expectedErr:          "error during rancher login",
+			expectedRefreshToken: "new-refresh-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rancherServer := newRefreshTestServers(t, tt.refreshStatus, tt.loginStatus)
+			cliCmd := newRefreshTestCommand(t, "rancher.example.com", config.SecretBackendFile)
+
+			cf, err := loadConfig(cliCmd)
+			require.NoError(t, err)
+			input := &LoginInput{server: rancherServer.URL, userID: "u-abcde", clusterID: "c-12345"}
+
+			cred, err := renewCredential(cliCmd, rancherServer.Client(), cf.Servers["rancher.example.com"], input)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				assert.Nil(t, cred)
+
+				// the rejected refresh token is removed, the rotated one is
+				// kept
+				cf, err := loadConfig(cliCmd)
+				require.NoError(t, err)
+				if tt.expectedRefreshToken == "" {
+					assert.Empty(t, cf.Servers["rancher.example.com"].OAuthTokens)
+					return
+				}
+				assert.Equal(t, tt.expectedRefreshToken, cf.Servers["rancher.example.com"].OAuthTokens["u-abcde"].RefreshToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedToken, cred.Status.Token)
+			assert.Equal(t, "genericOIDCProvider", input.authProvider)
+
+			require.NoError(t, cacheOAuthToken(cliCmd, "u-abcde", input))
+			cf, err = loadConfig(cliCmd)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedRefreshToken, cf.Servers["rancher.example.com"].OAuthTokens["u-abcde"].RefreshToken)
+		})
+	}
+}
+
+func TestRenewCredentialWithoutRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	cred, err := renewCredential(nil, http.DefaultClient, &config.ServerConfig{}, &LoginInput{userID: "u-abcde"})
+	require.NoError(t, err)
+	assert.Nil(t, cred)
+}
+
+func TestCacheOAuthTokenWithoutSecretStore(t *testing.T) {
+	cliCmd := newRefreshTestCommand(t, "rancher.example.com", "")
+
+	input := &LoginInput{
+		authProvider: "genericOIDCProvider",
+		oauthToken:   &oauth2.Token{RefreshToken: "new-refresh-token"},
+	}
+	require.NoError(t, cacheOAuthToken(cliCmd, "u-abcde", input))
+
+	cf, err := loadConfig(cliCmd)
+	require.NoError(t, err)
+	assert.Empty(t, cf.Servers["rancher.example.com"].OAuthTokens)
+}
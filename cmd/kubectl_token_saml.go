@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rancher/cli/config"
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	defaultSAMLPollInterval = 2 * time.Second
+	maxSAMLPollInterval     = 10 * time.Second
+	defaultSAMLTimeout      = 15 * time.Minute
+	// samlPendingDir holds the pending SAML logins, in the config directory.
+	samlPendingDir = "saml-logins"
+	// samlPendingTTL is how long a pending SAML login can be resumed.
+	samlPendingTTL = time.Hour
+)
+
+// samlOptions configures the polling of the auth token of a SAML login.
+type samlOptions struct {
+	pollInterval time.Duration
+	timeout      time.Duration
+	// requestID is the pending login to resume instead of starting a new one.
+	requestID string
+	// pendingDir is where pending logins are saved so that they can be
+	// resumed, they're not saved when empty.
+	pendingDir string
+	// secretBackend is the secret store of the config, holding the keys of
+	// the pending logins.
+	secretBackend string
+}
+
+// pendingSAMLLogin is a SAML login waiting for the user to log in, saved so
+// that it can be resumed from another terminal.
+type pendingSAMLLogin struct {
+	Server string `json:"server"`
+	// PrivateKey is kept in the secret store, never in the file.
+	PrivateKey []byte    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// SecretBackend is the secret store holding PrivateKey.
+	SecretBackend string `json:"secretBackend"`
+
+	id  string
+	key *rsa.PrivateKey
+}
+
+// samlFlags are the flags of the commands logging in through SAML providers.
+func samlFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:    "saml-poll-interval",
+			Usage:   "Initial interval between the checks for the completion of a SAML login, backing off up to 10s",
+			Value:   defaultSAMLPollInterval,
+			Sources: cli.EnvVars("RANCHER_SAML_POLL_INTERVAL"),
+		},
+		&cli.DurationFlag{
+			Name:    "saml-timeout",
+			Usage:   "How long to wait for a SAML login to complete",
+			Value:   defaultSAMLTimeout,
+			Sources: cli.EnvVars("RANCHER_SAML_TIMEOUT"),
+		},
+		&cli.StringFlag{
+			Name:  "saml-request-id",
+			Usage: "Resume the pending SAML login with this request ID, started from another terminal",
+		},
+	}
+}
+
+// newSAMLOptions returns the SAML options of cmd. Pending logins are only
+// saved with a secret backend, as their key decrypts the auth token.
+func newSAMLOptions(cmd *cli.Command, secretBackend string) samlOptions {
+	opts := samlOptions{
+		pollInterval:  cmd.Duration("saml-poll-interval"),
+		timeout:       cmd.Duration("saml-timeout"),
+		requestID:     cmd.String("saml-request-id"),
+		secretBackend: secretBackend,
+	}
+	if secretBackend != "" {
+		opts.pendingDir = filepath.Join(filepath.Dir(GetConfigPath(cmd)), samlPendingDir)
+	}
+	return opts
+}
+
+// samlAuth logs the user in through the Rancher dashboard, opened in the
+// browser, and polls for the auth token created once the user logged in. The
+// token is encrypted with a key generated for the login request: the key is
+// saved with the request ID so that a login interrupted or timed out can be
+// resumed, from another terminal too. Without a secret store the key is only
+// kept in memory.
+func samlAuth(ctx context.Context, client *http.Client, input *LoginInput, useV1Public bool, openBrowser openBrowserFunc) (managementClient.Token, error) {
+	token := managementClient.Token{}
+
+	opts := input.saml
+	if opts.pollInterval <= 0 {
+		opts.pollInterval = defaultSAMLPollInterval
+	}
+	if opts.timeout <= 0 {
+		opts.timeout = defaultSAMLTimeout
+	}
+
+	var (
+		login *pendingSAMLLogin
+		err   error
+	)
+	if opts.requestID != "" {
+		if opts.pendingDir == "" {
+			return token, errors.New("SAML logins can only be resumed with a secret store, see `rancher config migrate-secrets`")
+		}
+		login, err = loadPendingSAMLLogin(opts.pendingDir, opts.requestID, time.Now())
+		if err != nil {
+			return token, err
+		}
+		if login.Server != input.server {
+			return token, fmt.Errorf("login request %s was started for %s, not %s", login.id, login.Server, input.server)
+		}
+		customPrint(fmt.Sprintf("\nResuming Login Request Id: %s\n", login.id))
+	} else {
+		login, err = startSAMLLogin(input, opts.pendingDir, opts.secretBackend, openBrowser)
+		if err != nil {
+			return token, err
+		}
+	}
+
+	tokenURL := fmt.Sprintf(authTokenURL, input.server, login.id)
+	if !useV1Public {
+		tokenURL = fmt.Sprintf(authTokenURLv3, input.server, login.id)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	token, err = pollSAMLToken(ctx, client, tokenURL, opts.pollInterval)
+	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = errors.New("timed out waiting for the auth token")
+		case ctx.Err() != nil:
+			err = errors.New("interrupted waiting for the auth token")
+		default:
+			removePendingSAMLLogin(opts.pendingDir, login.id)
+			return token, err
+		}
+		if opts.pendingDir != "" {
+			err = fmt.Errorf("%w, resume the login with --saml-request-id %s", err, login.id)
+		}
+		return token, err
+	}
+	removePendingSAMLLogin(opts.pendingDir, login.id)
+
+	decoded, err := base64.StdEncoding.DecodeString(token.Token)
+	if err != nil {
+		return token, fmt.Errorf("error decoding auth token: %w", err)
+	}
+	decryptedBytes, err := login.key.Decrypt(nil, decoded, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		return token, fmt.Errorf("error decrypting auth token: %w", err)
+	}
+	token.Token = string(decryptedBytes)
+
+	// Delete the auth token.
+	deleteReq, err := http.NewRequest(http.MethodDelete, tokenURL, nil)
+	if err == nil {
+		deleteReq.Header.Set("content-type", "application/json")
+		deleteReq.Header.Set("accept", "application/json")
+
+		var resp *http.Response
+		resp, _, err = doRequest(client, deleteReq)
+		if err == nil {
+			switch resp.StatusCode {
+			case http.StatusOK, http.StatusNoContent, http.StatusNotFound: // Do nothing.
+			default:
+				err = fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+			}
+		}
+	}
+	if err != nil {
+		// Log the error and move on.
+		customPrint(fmt.Errorf("error deleting auth token: %s", err))
+	}
+
+	return token, nil
+}
+
+// startSAMLLogin generates the key and the ID of a new login request, saves
+// them in dir, the key in secretBackend if set, and opens the login page of
+// the dashboard.
+func startSAMLLogin(input *LoginInput, dir, secretBackend string, openBrowser openBrowserFunc) (*pendingSAMLLogin, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+
+	publicKey := privateKey.PublicKey
+	marshalKey, err := json.Marshal(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling public key: %w", err)
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(marshalKey)
+
+	id, err := generateKey()
+	if err != nil {
+		return nil, fmt.Errorf("error generating request id: %w", err)
+	}
+
+	loginURL, err := url.Parse(input.server + "/dashboard/auth/login")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing login url: %w", err)
+	}
+
+	q := url.Values{}
+	q.Set("cli", "true")
+	q.Set("requestId", id)
+	q.Set("publicKey", encodedKey)
+	q.Set("responseType", input.loginResponseType())
+	loginURL.RawQuery = q.Encode()
+
+	login := &pendingSAMLLogin{
+		Server:     input.server,
+		PrivateKey: x509.MarshalPKCS1PrivateKey(privateKey),
+		CreatedAt:  time.Now(),
+		id:         id,
+		key:        privateKey,
+	}
+
+	customPrint(fmt.Sprintf("\nLogin Request Id: %s\n", id))
+	if dir != "" {
+		if err := savePendingSAMLLogin(dir, secretBackend, login); err != nil {
+			logrus.Warnf("Unable to save the login request, it can't be resumed: %s", err)
+		} else {
+			customPrint(fmt.Sprintf("To resume the login from another terminal, add --saml-request-id %s to the command\n", id))
+		}
+	}
+
+	customPrint(fmt.Sprintf("\nLogin to Rancher Server at %s \n", loginURL))
+	if err := openBrowser(loginURL.String()); err != nil {
+		logrus.Debugf("Failed to open browser: %v", err)
+	}
+	return login, nil
+}
+
+// pollSAMLToken polls for the auth token of a login request until it's
+// created, backing off from interval up to maxSAMLPollInterval, or until ctx
+// is done.
+func pollSAMLToken(ctx context.Context, client *http.Client, tokenURL string, interval time.Duration) (managementClient.Token, error) {
+	token := managementClient.Token{}
+
+	maxInterval := max(interval, maxSAMLPollInterval)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return token, ctx.Err()
+		case <-timer.C:
+		}
+
+		getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, nil)
+		if err != nil {
+			return token, fmt.Errorf("error creating get token request: %w", err)
+		}
+		getReq.Header.Set("content-type", "application/json")
+		getReq.Header.Set("accept", "application/json")
+
+		resp, respBody, err := doRequest(client, getReq)
+		if err != nil {
+			if ctx.Err() != nil {
+				return token, ctx.Err()
+			}
+			return token, fmt.Errorf("error fetching auth token: %w", err)
+		}
+		switch resp.StatusCode {
+		case http.StatusOK: // Found the token.
+			if err := json.Unmarshal(respBody, &token); err != nil {
+				return token, fmt.Errorf("error unmarshaling auth token response: %w", err)
+			}
+			if token.Token != "" {
+				return token, nil
+			}
+		case http.StatusNotFound: // Token not yet created, continue polling.
+		default:
+			return token, fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+
+		interval = min(interval*2, maxInterval)
+		timer.Reset(interval)
+	}
+}
+
+// savePendingSAMLLogin saves the login in dir, only readable by the user. Its
+// key, decrypting the auth token, is saved in the secret store of the config
+// given by secretBackend. The logins that can't be resumed anymore are
+// removed.
+func savePendingSAMLLogin(dir, secretBackend string, login *pendingSAMLLogin) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > samlPendingTTL {
+			removePendingSAMLLogin(dir, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+
+	store, err := config.OpenSecretStore(secretBackend, filepath.Dir(dir))
+	if err != nil {
+		return err
+	}
+	if err := store.Set(samlSecretKey(login.id), base64.StdEncoding.EncodeToString(login.PrivateKey)); err != nil {
+		return fmt.Errorf("error saving the key of login request %s: %w", login.id, err)
+	}
+
+	saved := *login
+	saved.SecretBackend = secretBackend
+	content, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, login.id+".json"), content, 0600)
+}
+
+// loadPendingSAMLLogin loads the login with the given request ID from dir.
+func loadPendingSAMLLogin(dir, id string, now time.Time) (*pendingSAMLLogin, error) {
+	// the ID is a file name
+	if id != filepath.Base(id) || dir == "" {
+		return nil, fmt.Errorf("invalid login request %s", id)
+	}
+
+	login, err := readPendingSAMLLogin(dir, id)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("login request %s not found, it completed or was started on another machine", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if now.Sub(login.CreatedAt) > samlPendingTTL {
+		removePendingSAMLLogin(dir, id)
+		return nil, fmt.Errorf("login request %s expired, log in again", id)
+	}
+
+	store, err := config.OpenSecretStore(login.SecretBackend, filepath.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := store.Get(samlSecretKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("error loading the key of login request %s: %w", id, err)
+	}
+	if login.PrivateKey, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+		return nil, fmt.Errorf("error decoding the key of login request %s: %w", id, err)
+	}
+	if login.key, err = x509.ParsePKCS1PrivateKey(login.PrivateKey); err != nil {
+		return nil, fmt.Errorf("error parsing the key of login request %s: %w", id, err)
+	}
+	return login, nil
+}
+
+func readPendingSAMLLogin(dir, id string) (*pendingSAMLLogin, error) {
+	content, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	login := &pendingSAMLLogin{id: id}
+	if err := json.Unmarshal(content, login); err != nil {
+		return nil, fmt.Errorf("error unmarshaling login request %s: %w", id, err)
+	}
+	return login, nil
+}
+
+// removePendingSAMLLogin removes the login from dir, and its key from the
+// secret store.
+func removePendingSAMLLogin(dir, id string) {
+	if dir == "" {
+		return
+	}
+	if login, err := readPendingSAMLLogin(dir, id); err == nil && login.SecretBackend != "" {
+		store, err := config.OpenSecretStore(login.SecretBackend, filepath.Dir(dir))
+		if err == nil {
+			err = store.Delete(samlSecretKey(id))
+		}
+		if err != nil && !errors.Is(err, config.ErrSecretNotFound) {
+			logrus.Debugf("Unable to remove the key of login request %s: %s", id, err)
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		logrus.Debugf("Unable to remove login request %s: %s", id, err)
+	}
+}
+
+// samlSecretKey is the key of the secret store holding the key of a pending
+// login.
+func samlSecretKey(id string) string {
+	return "saml-logins/" + id + "/privateKey"
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSAMLTestServer returns a server creating the auth token encrypted with
+// the public key of the login URL once loggedIn is set.
+func newSAMLTestServer(t *testing.T, loggedIn *atomic.Bool, publicKey *atomic.Pointer[rsa.PublicKey]) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var deleted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if !loggedIn.Load() {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey.Load(), []byte("kubeconfig-u-abcde:secret"), nil)
+			require.NoError(t, err)
+			fmt.Fprintf(w, `{"token": %q, "userId": "u-abcde"}`, base64.StdEncoding.EncodeToString(encrypted))
+		case http.MethodDelete:
+			deleted.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &deleted
+}
+
+// loginPublicKey returns the public key of the login URL opened in the browser.
+func loginPublicKey(t *testing.T, loginURL string) *rsa.PublicKey {
+	t.Helper()
+
+	u, err := url.Parse(loginURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/dashboard/auth/login", u.Path)
+	decoded, err := base64.StdEncoding.DecodeString(u.Query().Get("publicKey"))
+	require.NoError(t, err)
+	publicKey := &rsa.PublicKey{}
+	require.NoError(t, json.Unmarshal(decoded, publicKey))
+	return publicKey
+}
+
+// newSAMLTestOptions returns SAML options saving the pending logins in a
+// config directory with a file secret store.
+func newSAMLTestOptions(t *testing.T, timeout time.Duration) samlOptions {
+	t.Setenv("RANCHER_SECRETS_PASSPHRASE", "correct horse")
+	return samlOptions{
+		pollInterval:  10 * time.Millisecond,
+		timeout:       timeout,
+		pendingDir:    filepath.Join(t.TempDir(), samlPendingDir),
+		secretBackend: config.SecretBackendFile,
+	}
+}
+
+func TestSAMLAuth(t *testing.T) {
+	var (
+		loggedIn  atomic.Bool
+		publicKey atomic.Pointer[rsa.PublicKey]
+	)
+	server, deleted := newSAMLTestServer(t, &loggedIn, &publicKey)
+
+	input := &LoginInput{
+		server: server.URL,
+		saml:   newSAMLTestOptions(t, time.Minute),
+	}
+	openBrowser := func(loginURL string) error {
+		publicKey.Store(loginPublicKey(t, loginURL))
+		loggedIn.Store(true)
+		return nil
+	}
+
+	token, err := samlAuth(context.Background(), server.Client(), input, true, openBrowser)
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-abcde:secret", token.Token)
+	assert.Equal(t, "u-abcde", token.UserID)
+	assert.Equal(t, int32(1), deleted.Load())
+
+	// the completed login can't be resumed
+	entries, err := os.ReadDir(input.saml.pendingDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSAMLAuthResume(t *testing.T) {
+	var (
+		loggedIn  atomic.Bool
+		publicKey atomic.Pointer[rsa.PublicKey]
+	)
+	server, _ := newSAMLTestServer(t, &loggedIn, &publicKey)
+
+	input := &LoginInput{
+		server: server.URL,
+		saml:   newSAMLTestOptions(t, 50*time.Millisecond),
+	}
+	var requestID string
+	openBrowser := func(loginURL string) error {
+		publicKey.Store(loginPublicKey(t, loginURL))
+		u, err := url.Parse(loginURL)
+		require.NoError(t, err)
+		requestID = u.Query().Get("requestId")
+		return nil
+	}
+
+	_, err := samlAuth(context.Background(), server.Client(), input, true, openBrowser)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out waiting for the auth token")
+	assert.Contains(t, err.Error(), "--saml-request-id "+requestID)
+
+	// the user logs in, and the login is resumed from another terminal
+	loggedIn.Store(true)
+	resumed := *input
+	resumed.saml.requestID = requestID
+	noBrowser := func(string) error {
+		t.Error("the browser is not opened when resuming a login")
+		return nil
+	}
+
+	token, err := samlAuth(context.Background(), server.Client(), &resumed, true, noBrowser)
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-abcde:secret", token.Token)
+
+	_, err = samlAuth(context.Background(), server.Client(), &resumed, true, noBrowser)
+	assert.ErrorContains(t, err, "not found")
+
+	// without a secret store, the key of the login is only kept in memory
+	resumed.saml.pendingDir, resumed.saml.secretBackend = "", ""
+	_, err = samlAuth(context.Background(), server.Client(), &resumed, true, noBrowser)
+	assert.ErrorContains(t, err, "SAML logins can only be resumed with a secret store")
+}
+
+func TestSAMLAuthCanceled(t *testing.T) {
+	t.Parallel()
+
+	var (
+		loggedIn  atomic.Bool
+		publicKey atomic.Pointer[rsa.PublicKey]
+	)
+	server, _ := newSAMLTestServer(t, &loggedIn, &publicKey)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	input := &LoginInput{
+		server: server.URL,
+		saml:   samlOptions{pollInterval: 10 * time.Millisecond, timeout: time.Minute},
+	}
+	openBrowser := func(string) error {
+		cancel()
+		return nil
+	}
+
+	_, err := samlAuth(ctx, server.Client(), input, true, openBrowser)
+	assert.EqualError(t, err, "interrupted waiting for the auth token")
+}
+
+func TestPendingSAMLLoginWithSecretBackend(t *testing.T) {
+	t.Setenv("RANCHER_SECRETS_PASSPHRASE", "correct horse")
+
+	configDir := t.TempDir()
+	dir := filepath.Join(configDir, samlPendingDir)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	createdAt := time.Now()
+	login := &pendingSAMLLogin{Server: "https://rancher.example.com", CreatedAt: createdAt, id: "abcde", key: key}
+	login.PrivateKey = x509.MarshalPKCS1PrivateKey(key)
+	require.NoError(t, savePendingSAMLLogin(dir, config.SecretBackendFile, login))
+
+	// the key is kept in the secret store, not in the file
+	content, err := os.ReadFile(filepath.Join(dir, "abcde.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "privateKey")
+	store, err := config.OpenSecretStore(config.SecretBackendFile, configDir)
+	require.NoError(t, err)
+	_, err = store.Get(samlSecretKey("abcde"))
+	require.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(dir, "abcde.json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := loadPendingSAMLLogin(dir, "abcde", createdAt.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "https://rancher.example.com", loaded.Server)
+	assert.True(t, key.Equal(loaded.key))
+
+	_, err = loadPendingSAMLLogin(dir, "../abcde", createdAt)
+	assert.EqualError(t, err, "invalid login request ../abcde")
+
+	removePendingSAMLLogin(dir, "abcde")
+	_, err = os.Stat(filepath.Join(dir, "abcde.json"))
+	assert.True(t, os.IsNotExist(err))
+	store, err = config.OpenSecretStore(config.SecretBackendFile, configDir)
+	require.NoError(t, err)
+	_, err = store.Get(samlSecretKey("abcde"))
+	assert.ErrorIs(t, err, config.ErrSecretNotFound)
+
+	require.NoError(t, savePendingSAMLLogin(dir, config.SecretBackendFile, login))
+	_, err = loadPendingSAMLLogin(dir, "abcde", createdAt.Add(2*time.Hour))
+	assert.EqualError(t, err, "login request abcde expired, log in again")
+	_, err = os.Stat(filepath.Join(dir, "abcde.json"))
+	assert.True(t, os.IsNotExist(err))
+}
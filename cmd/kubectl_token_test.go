@@ -216,8 +216,9 @@ func TestGetAuthProviders(t *testing.T) {
 
 		require.NoError(t, err)
 		assert.True(t, useV1Public)
-		require.Len(t, providers, 1, "should only return supported providers")
+		require.Len(t, providers, 2, "should only return supported providers")
 		assert.Equal(t, "localProvider", providers[0].GetType())
+		assert.IsType(t, &apiv3.GithubProvider{}, providers[1])
 	})
 }
 
@@ -455,42 +456,92 @@ func TestCacheCredential(t *testing.T) {
 	err := app.Run(context.Background(), []string{"test", "--server=rancher.example.com", "--config=" + configDir})
 	require.NoError(t, err)
 
-	serverConfig, err := lookupServerConfig(cliCmd)
-	if err != nil {
-		t.Fatal(err)
-	}
+	cf, serverConfig, err := lookupServerConfig(cliCmd)
+	require.NoError(t, err)
+	assert.Equal(t, "rancher.example.com", serverConfig.URL)
 
 	cred := &config.ExecCredential{Status: &config.ExecCredentialStatus{Token: "test-token"}}
 
-	err = cacheCredential(cliCmd, serverConfig, "dev-server", cred)
-	require.NoError(t, err)
-
-	cfg, err := loadConfig(cliCmd)
+	err = cacheCredential(cf, "https://rancher.example.com", "dev-server", cred)
 	require.NoError(t, err)
 
+	// updated by another process
 	expires := &config.Time{Time: time.Now().Add(time.Hour * 2)}
-	cfg.CurrentServer = "rancher.example.com"
-	cfg.Servers["rancher.example.com"].KubeCredentials["dev-server"].Status.ClientKeyData = "this-is-not-real"
-	cfg.Servers["rancher.example.com"].KubeCredentials["dev-server"].Status.ExpirationTimestamp = expires
-
-	err = cfg.Write()
-	require.NoError(t, err)
-
-	serverConfig, err = cfg.GetCurrentServer()
+	err = cf.UpdateCredentials(func(s *config.CredentialStore) error {
+		cred := s.Get("rancher.example.com", "dev-server")
+		require.NotNil(t, cred)
+		cred.Status.ClientKeyData = "this-is-not-real"
+		cred.Status.ExpirationTimestamp = expires
+		return nil
+	})
 	require.NoError(t, err)
 
 	cred = &config.ExecCredential{Status: &config.ExecCredentialStatus{Token: "new-token"}}
 
-	err = cacheCredential(cliCmd, serverConfig, "local", cred)
+	err = cacheCredential(cf, "rancher.example.com", "local", cred)
 	require.NoError(t, err)
 
-	cfg, err = loadConfig(cliCmd)
+	// no server is added to the config
+	cf, err = loadConfig(cliCmd)
 	require.NoError(t, err)
+	assert.Empty(t, cf.Servers)
 
-	clientKeyData := cfg.Servers["rancher.example.com"].KubeCredentials["dev-server"].Status.ClientKeyData
+	creds, err := cf.LoadCredentials()
+	require.NoError(t, err)
+	require.Contains(t, creds.Servers, "https://rancher.example.com")
+
+	clientKeyData := creds.Get("https://rancher.example.com", "dev-server").Status.ClientKeyData
 	assert.Equal(t, "this-is-not-real", clientKeyData)
 
-	expirationTimestamp := cfg.Servers["rancher.example.com"].KubeCredentials["dev-server"].Status.ExpirationTimestamp
+	expirationTimestamp := creds.Get("https://rancher.example.com", "dev-server").Status.ExpirationTimestamp
 	require.NotNil(t, expirationTimestamp)
 	assert.True(t, expirationTimestamp.Equal(expires.Time))
+
+	assert.Equal(t, "new-token", creds.Get("https://rancher.example.com", "local").Status.Token)
+}
+
+func TestNewCredentialHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	server, caCerts := newCACertsServer(t)
+
+	tests := []struct {
+		name        string
+		caCerts     string
+		input       *LoginInput
+		expectedErr bool
+	}{
+		{
+			name:    "CA certs of the server config",
+			caCerts: caCerts,
+			input:   &LoginInput{},
+		},
+		{
+			name:        "no CA certs",
+			input:       &LoginInput{},
+			expectedErr: true,
+		},
+		{
+			name:  "skip verify",
+			input: &LoginInput{skipVerify: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := newCredentialHTTPClient(&config.ServerConfig{URL: server.URL, CACerts: tt.caCerts}, tt.input)
+			require.NoError(t, err)
+
+			resp, err := client.Get(server.URL + "/ping")
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
 }
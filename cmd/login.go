@@ -30,15 +30,36 @@ type CACertResponse struct {
 
 func LoginCommand() *cli.Command {
 	return &cli.Command{
-		Name:      "login",
-		Aliases:   []string{"l"},
-		Usage:     "Login to a Rancher server",
+		Name:    "login",
+		Aliases: []string{"l"},
+		Usage:   "Login to a Rancher server",
+		Description: `
+Logs in to a Rancher server and makes it the current server. Without --token,
+the CLI logs in through one of the auth providers of the server, asking for
+the credentials, and creates an API token that is stored in the config.
+
+When the certificate of the server is signed by an unknown authority and no
+--cacert is given, the CA of the server is fetched and trusted once its
+fingerprint is confirmed, interactively or with --ca-fingerprint.
+
+Example:
+	# Log in with a token created in the Rancher UI
+	$ rancher login https://rancher.example.com --token token-abcde:secret
+
+	# Log in with a username and password
+	$ rancher login https://rancher.example.com --auth-provider localProvider
+
+	# Trust the self-signed CA of the server without being asked
+	$ rancher login https://rancher.example.com --ca-fingerprint AB:CD:...:EF
+`,
 		Action:    loginSetup,
 		ArgsUsage: "[SERVERURL]",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
+			// same as the global --context
 			&cli.StringFlag{
-				Name:  "context",
-				Usage: "Set the context during login",
+				Name:   "context",
+				Usage:  "Set the context during login",
+				Hidden: true,
 			},
 			&cli.StringFlag{
 				Name:    "token",
@@ -49,11 +70,23 @@ func LoginCommand() *cli.Command {
 				Name:  "cacert",
 				Usage: "Location of the CACerts to use",
 			},
+			&cli.StringFlag{
+				Name:  "ca-fingerprint",
+				Usage: "SHA-256 fingerprint of the CA to trust when the server certificate is signed by an unknown authority",
+			},
 			&cli.StringFlag{
 				Name:  "name",
 				Usage: "Name of the Server",
 			},
-		},
+			&cli.StringFlag{
+				Name:  "auth-provider",
+				Usage: "Name of the auth provider to log in with when no token is given",
+			},
+			&cli.StringFlag{
+				Name:  "auth-flow",
+				Usage: "Auth flow to use for OAuth providers: 'devicecode' (default) or 'authcode'",
+			},
+		}, samlFlags()...),
 	}
 }
 
@@ -62,11 +95,6 @@ func loginSetup(ctx context.Context, cmd *cli.Command) error {
 		return cli.ShowCommandHelp(ctx, cmd, "login")
 	}
 
-	cf, err := loadConfig(cmd)
-	if err != nil {
-		return err
-	}
-
 	serverName := cmd.String("name")
 	if serverName == "" {
 		serverName = "rancherDefault"
@@ -83,19 +111,6 @@ func loginSetup(ctx context.Context, cmd *cli.Command) error {
 	u.Path = ""
 	serverConfig.URL = u.String()
 
-	if cmd.String("token") != "" {
-		auth := SplitOnColon(cmd.String("token"))
-		if len(auth) != 2 {
-			return errors.New("invalid token")
-		}
-		serverConfig.AccessKey = auth[0]
-		serverConfig.SecretKey = auth[1]
-		serverConfig.TokenKey = cmd.String("token")
-	} else {
-		// This can be removed once username and password is accepted
-		return errors.New("token flag is required")
-	}
-
 	if cmd.String("cacert") != "" {
 		cert, err := loadAndVerifyCert(cmd.String("cacert"))
 		if err != nil {
@@ -105,33 +120,67 @@ func loginSetup(ctx context.Context, cmd *cli.Command) error {
 
 	}
 
-	c, err := cliclient.NewManagementClient(serverConfig)
+	// keep the settings edited with 'rancher config set' when logging in again
+	cf, err := loadConfig(cmd)
 	if err != nil {
 		return err
 	}
+	if cf.FromEnvironment() {
+		return config.ErrEnvironmentConfig
+	}
+	if existing := cf.Servers[serverName]; existing != nil {
+		serverConfig.ProxyURL = existing.ProxyURL
+		serverConfig.HTTPTimeoutSeconds = existing.HTTPTimeoutSeconds
+		if serverConfig.CACerts == "" && existing.URL == serverConfig.URL {
+			serverConfig.CACerts = existing.CACerts
+		}
+	}
 
-	proj, err := getProjectContext(cmd, c)
+	if cmd.String("cacert") == "" {
+		if err := loginCACerts(cmd, serverConfig); err != nil {
+			return err
+		}
+	}
+
+	token := cmd.String("token")
+	if token == "" {
+		// no token, log in through an auth provider and create one
+		token, err = loginInteractive(ctx, cmd, serverConfig, cf.SecretBackend)
+		if err != nil {
+			return err
+		}
+	}
+
+	auth := SplitOnColon(token)
+	if len(auth) != 2 {
+		return errors.New("invalid token")
+	}
+	serverConfig.AccessKey = auth[0]
+	serverConfig.SecretKey = auth[1]
+	serverConfig.TokenKey = token
+
+	c, err := cliclient.NewManagementClient(serverConfig)
 	if err != nil {
 		return err
 	}
 
-	// Set the default server and proj for the user
-	serverConfig.Project = proj
-	cf.CurrentServer = serverName
-	cf.Servers[serverName] = serverConfig
-
-	err = cf.Write()
+	proj, err := getProjectContext(cmd, c)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Set the default server and proj for the user
+	serverConfig.Project = proj
+	return config.Update(GetConfigPath(cmd), func(cf *config.Config) error {
+		cf.CurrentServer = serverName
+		cf.Servers[serverName] = serverConfig
+		return nil
+	})
 }
 
 func getProjectContext(cmd *cli.Command, c *cliclient.MasterClient) (string, error) {
 	// If context is given
-	if cmd.String("context") != "" {
-		context := cmd.String("context")
+	if context := configOverrides(cmd).Context; context != "" {
 		// Check if given context is in valid format
 		_, _, err := parseClusterAndProjectID(context)
 		if err != nil {
@@ -247,7 +296,7 @@ func loginContext(ctx context.Context, cmd *cli.Command) error {
 	}
 	clusterName := getClusterName(cluster)
 
-	project, err := getProjectByID(c, c.UserConfig.Project)
+	project, err := getProjectByID(c, c.UserConfig.GetCurrentProject())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rancher/cli/config"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+)
+
+const (
+	pingURL     = "%s/ping"
+	cacertsURL  = "%s/v3/settings/cacerts"
+	sha256Label = "sha256:"
+)
+
+// confirmCAFunc asks whether the CA certificates fetched from the server are trusted.
+type confirmCAFunc func(certs []*x509.Certificate) (bool, error)
+
+// loginCACerts trusts the CA of the server on first use: when the certificate
+// of the server isn't signed by a trusted CA, the cacerts setting of the server
+// is fetched and stored in the config once its fingerprint is confirmed, either
+// by --ca-fingerprint or by the user.
+func loginCACerts(cmd *cli.Command, serverConfig *config.ServerConfig) error {
+	fingerprint := cmd.String("ca-fingerprint")
+	if fingerprint != "" {
+		return trustServerCA(serverConfig, fingerprint, nil)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return trustServerCA(serverConfig, "", nil)
+	}
+	return trustServerCA(serverConfig, "", confirmCACerts)
+}
+
+// trustServerCA sets the CA certs of the server config to the cacerts setting
+// of the server if its certificate isn't trusted. The CA must either match
+// fingerprint or be accepted by confirm; it's rejected when both are empty.
+func trustServerCA(serverConfig *config.ServerConfig, fingerprint string, confirm confirmCAFunc) error {
+	err := pingServer(serverConfig)
+	if err == nil || !isUnknownAuthority(err) {
+		// other errors are reported by the requests of the login
+		return nil
+	}
+
+	caCerts, err := getServerCACerts(serverConfig)
+	if err != nil {
+		return err
+	}
+	certs, err := parseCertificates(caCerts)
+	if err != nil {
+		return fmt.Errorf("invalid cacerts setting: %w", err)
+	}
+
+	switch {
+	case fingerprint != "":
+		pinned := matchFingerprint(certs, fingerprint)
+		if pinned == nil {
+			return fmt.Errorf("the CA certificate of %s doesn't match the fingerprint %s", serverConfig.URL, fingerprint)
+		}
+		// only the pinned certificate is trusted, not the others of the
+		// bundle, which may have been added by a man-in-the-middle
+		caCerts = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pinned.Raw}))
+	case confirm != nil:
+		ok, err := confirm(certs)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("the CA certificate of the server was not trusted, login aborted")
+		}
+	default:
+		return fmt.Errorf("the certificate of %s is signed by an unknown authority, use --ca-fingerprint or --cacert to trust it", serverConfig.URL)
+	}
+
+	trusted := *serverConfig
+	trusted.CACerts = caCerts
+	if err := pingServer(&trusted); err != nil {
+		return fmt.Errorf("the certificate of %s is not signed by its cacerts setting: %w", serverConfig.URL, err)
+	}
+	serverConfig.CACerts = caCerts
+	return nil
+}
+
+// pingServer checks whether the certificate of the server is trusted.
+func pingServer(serverConfig *config.ServerConfig) error {
+	client, err := newServerHTTPClient(serverConfig)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(pingURL, serverConfig.URL), nil)
+	if err != nil {
+		return err
+	}
+	_, _, err = doRequest(client, req)
+	return err
+}
+
+// isUnknownAuthority reports whether err is a certificate signed by an unknown authority.
+func isUnknownAuthority(err error) bool {
+	var authorityErr x509.UnknownAuthorityError
+	return errors.As(err, &authorityErr)
+}
+
+// getServerCACerts returns the cacerts setting of the server. The certificate
+// of the server can't be verified yet, the content must be checked by the
+// caller before it's trusted.
+func getServerCACerts(serverConfig *config.ServerConfig) (string, error) {
+	client, err := newHTTPClient(serverConfig, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(cacertsURL, serverConfig.URL), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, body, err := doRequest(client, req)
+	if err != nil {
+		return "", fmt.Errorf("error getting the cacerts setting: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error getting the cacerts setting: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	var setting CACertResponse
+	if err := json.Unmarshal(body, &setting); err != nil {
+		return "", fmt.Errorf("error unmarshaling the cacerts setting: %w", err)
+	}
+	if strings.TrimSpace(setting.Value) == "" {
+		return "", fmt.Errorf("the certificate of %s is signed by an unknown authority and the server has no cacerts setting, use --cacert", serverConfig.URL)
+	}
+	return setting.Value, nil
+}
+
+// parseCertificates parses the PEM encoded CA certificates of a chain.
+func parseCertificates(content string) ([]*x509.Certificate, error) {
+	var (
+		certs []*x509.Certificate
+		rest  = []byte(content)
+	)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no cert was found")
+	}
+	if !certs[0].IsCA {
+		return nil, errors.New("caCerts is not valid")
+	}
+	return certs, nil
+}
+
+// certFingerprint returns the SHA-256 fingerprint of cert in the format of
+// openssl, e.g. AB:CD:...
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+// matchFingerprint returns the certificate of the chain with the given SHA-256
+// fingerprint, which is case insensitive, with or without colons and
+// optionally prefixed with "sha256:". It returns nil if none matches.
+func matchFingerprint(certs []*x509.Certificate, fingerprint string) *x509.Certificate {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(s))
+		s = strings.TrimPrefix(s, sha256Label)
+		return strings.ReplaceAll(s, ":", "")
+	}
+	fingerprint = normalize(fingerprint)
+	for _, cert := range certs {
+		if normalize(certFingerprint(cert)) == fingerprint {
+			return cert
+		}
+	}
+	return nil
+}
+
+func confirmCACerts(certs []*x509.Certificate) (bool, error) {
+	fmt.Fprintln(os.Stderr, "The certificate of the server is signed by an unknown authority. The server provides this CA:")
+	for _, cert := range certs {
+		fmt.Fprintf(os.Stderr, "  Subject:     %s\n", cert.Subject)
+		fmt.Fprintf(os.Stderr, "  Fingerprint: %s%s\n", sha256Label, certFingerprint(cert))
+	}
+	answer, err := customPrompt("Do you trust this CA? Make sure the fingerprint matches the one of your server [y/N]: ", true)
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCACertsServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	return newCACertsBundleServer(t, "")
+}
+
+// newCACertsBundleServer returns a server whose cacerts setting is its own
+// certificate followed by extra, and its certificate, PEM encoded.
+func newCACertsBundleServer(t *testing.T, extra string) (*httptest.Server, string) {
+	t.Helper()
+
+	var caCerts string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ping":
+			_, _ = w.Write([]byte("pong"))
+		case "/v3/settings/cacerts":
+			_ = json.NewEncoder(w).Encode(CACertResponse{Name: "cacerts", Value: caCerts})
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	serverCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	caCerts = serverCert + extra
+	return server, serverCert
+}
+
+func TestTrustServerCA(t *testing.T) {
+	t.Parallel()
+
+	server, caCerts := newCACertsServer(t)
+	fingerprint := certFingerprint(server.Certificate())
+
+	tests := []struct {
+		name            string
+		caCerts         string
+		fingerprint     string
+		confirm         confirmCAFunc
+		expectedCACerts string
+		expectedErr     string
+	}{
+		{
+			name:            "matching fingerprint",
+			fingerprint:     fingerprint,
+			expectedCACerts: caCerts,
+		},
+		{
+			name:            "lowercase fingerprint without colons",
+			fingerprint:     "sha256:" + strings.ToLower(strings.ReplaceAll(fingerprint, ":", "")),
+			expectedCACerts: caCerts,
+		},
+		{
+			name:        "fingerprint mismatch",
+			fingerprint: strings.Repeat("00:", 31) + "00",
+			expectedErr: "doesn't match the fingerprint",
+		},
+		{
+			name: "confirmed",
+			confirm: func(certs []*x509.Certificate) (bool, error) {
+				require.Len(t, certs, 1)
+				return true, nil
+			},
+			expectedCACerts: caCerts,
+		},
+		{
+			name:        "not confirmed",
+			confirm:     func([]*x509.Certificate) (bool, error) { return false, nil },
+			expectedErr: "the CA certificate of the server was not trusted, login aborted",
+		},
+		{
+			name:        "non-interactive",
+			expectedErr: "is signed by an unknown authority, use --ca-fingerprint or --cacert to trust it",
+		},
+		{
+			name:            "already trusted",
+			caCerts:         caCerts,
+			confirm:         func([]*x509.Certificate) (bool, error) { return false, nil },
+			expectedCACerts: caCerts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			serverConfig := &config.ServerConfig{URL: server.URL, CACerts: tt.caCerts}
+			err := trustServerCA(serverConfig, tt.fingerprint, tt.confirm)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				assert.Empty(t, serverConfig.CACerts)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCACerts, serverConfig.CACerts)
+		})
+	}
+}
+
+func TestTrustServerCABundle(t *testing.T) {
+	t.Parallel()
+
+	otherCA := newTestCACert(t)
+	otherCerts, err := parseCertificates(otherCA)
+	require.NoError(t, err)
+
+	// only the pinned CA of the bundle is trusted
+	server, serverCert := newCACertsBundleServer(t, otherCA)
+	serverConfig := &config.ServerConfig{URL: server.URL}
+	require.NoError(t, trustServerCA(serverConfig, certFingerprint(server.Certificate()), nil))
+	assert.Equal(t, serverCert, serverConfig.CACerts)
+
+	// a man-in-the-middle serving the pinned CA next to its own CA, which
+	// signed its certificate, isn't trusted
+	serverConfig = &config.ServerConfig{URL: server.URL}
+	err = trustServerCA(serverConfig, certFingerprint(otherCerts[0]), nil)
+	assert.ErrorContains(t, err, "is not signed by its cacerts setting")
+	assert.Empty(t, serverConfig.CACerts)
+}
+
+func TestParseCertificates(t *testing.T) {
+	t.Parallel()
+
+	caCert := newTestCACert(t)
+	certs, err := parseCertificates(caCert + caCert)
+	require.NoError(t, err)
+	assert.Len(t, certs, 2)
+
+	_, err = parseCertificates("not a cert")
+	assert.EqualError(t, err, "no cert was found")
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/cli/config"
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	v3TokensURL  = "%s/v3/tokens"
+	extTokensURL = "%s/apis/ext.cattle.io/v1/tokens"
+	logoutURLv3  = "%s/v3/tokens?action=logout"
+)
+
+// loginInteractive logs the user in through one of the auth providers of the
+// server and returns an API token minted with the resulting session. The
+// session is logged out once the API token is created. secretBackend is the
+// secret store of the config, keeping the key of a pending SAML login.
+func loginInteractive(ctx context.Context, cmd *cli.Command, serverConfig *config.ServerConfig, secretBackend string) (string, error) {
+	client, err := newServerHTTPClient(serverConfig)
+	if err != nil {
+		return "", err
+	}
+
+	input := &LoginInput{
+		server:       serverConfig.URL,
+		authProvider: cmd.String("auth-provider"),
+		authFlow:     cmd.String("auth-flow"),
+		responseType: "json",
+		saml:         newSAMLOptions(cmd, secretBackend),
+	}
+	session, err := authenticate(ctx, client, input)
+	if err != nil {
+		return "", err
+	}
+	if session.BearerToken == "" {
+		return "", errors.New("login failed, no token was returned by the server")
+	}
+	defer logoutSession(client, serverConfig.URL, session.BearerToken)
+
+	token, err := createAPIToken(client, serverConfig.URL, session.BearerToken, apiTokenSpec{Description: apiTokenDescription()})
+	if err != nil {
+		return "", err
+	}
+	return token.BearerToken, nil
+}
+
+// newServerHTTPClient returns a client for the server, trusting its CA certs.
+func newServerHTTPClient(serverConfig *config.ServerConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if serverConfig.CACerts != "" {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(serverConfig.CACerts)) {
+			return nil, errors.New("unable to parse the CA certs of the server")
+		}
+		tlsConfig.RootCAs = roots
+	}
+	return newHTTPClient(serverConfig, tlsConfig)
+}
+
+// apiTokenDescription describes the API tokens created by the CLI, so that
+// they can be told apart in the UI.
+func apiTokenDescription() string {
+	if hostname, err := os.Hostname(); err == nil {
+		return "Rancher CLI on " + hostname
+	}
+	return "Rancher CLI"
+}
+
+// apiTokenSpec describes the API token to create.
+type apiTokenSpec struct {
+	Description string
+	// TTL is capped by the max TTL of the server, 0 meaning no expiration.
+	TTL time.Duration
+	// ClusterID scopes the token to a cluster, when set.
+	ClusterID string
+}
+
+// createAPIToken creates an API token using the bearer token of a session or
+// of another API token. It tries the v3 Management API first and falls back to
+// ext.cattle.io/v1.
+func createAPIToken(client *http.Client, server, bearerToken string, spec apiTokenSpec) (loginToken, error) {
+	body, err := json.Marshal(map[string]any{
+		"type":        "token",
+		"description": spec.Description,
+		"ttl":         spec.TTL.Milliseconds(),
+		"clusterId":   spec.ClusterID,
+	})
+	if err != nil {
+		return loginToken{}, err
+	}
+
+	resp, respBody, err := doBearerRequest(client, http.MethodPost, fmt.Sprintf(v3TokensURL, server), bearerToken, body)
+	if err != nil {
+		return loginToken{}, fmt.Errorf("error creating API token: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return parseAPIToken(respBody)
+	case http.StatusNotFound: // v3 tokens are not served anymore.
+	default:
+		return loginToken{}, fmt.Errorf("error creating API token: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	body, err = json.Marshal(extv1.Token{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "ext.cattle.io/v1",
+			Kind:       "Token",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "token-",
+		},
+		Spec: extv1.TokenSpec{
+			Description: spec.Description,
+			TTL:         spec.TTL.Milliseconds(),
+			ClusterName: spec.ClusterID,
+		},
+	})
+	if err != nil {
+		return loginToken{}, err
+	}
+
+	resp, respBody, err = doBearerRequest(client, http.MethodPost, fmt.Sprintf(extTokensURL, server), bearerToken, body)
+	if err == nil && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if err != nil {
+		return loginToken{}, fmt.Errorf("error creating API token: %w", err)
+	}
+	return parseAPIToken(respBody)
+}
+
+func parseAPIToken(body []byte) (loginToken, error) {
+	token, err := parseLoginResponse(body)
+	if err != nil {
+		return loginToken{}, fmt.Errorf("error unmarshaling API token: %w", err)
+	}
+	if token.BearerToken == "" {
+		return loginToken{}, errors.New("error creating API token: no token was returned by the server")
+	}
+	return token, nil
+}
+
+// logoutSession revokes the session token used to mint the API token. A
+// failure only leaves the session to expire on its own, so it's not fatal.
+func logoutSession(client *http.Client, server, bearerToken string) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	if name, _, ok := strings.Cut(strings.TrimPrefix(bearerToken, extTokenIDPrefix), ":"); ok && strings.HasPrefix(bearerToken, extTokenIDPrefix) {
+		resp, _, err = doBearerRequest(client, http.MethodDelete, fmt.Sprintf(extTokensURL, server)+"/"+name, bearerToken, nil)
+	} else {
+		resp, _, err = doBearerRequest(client, http.MethodPost, fmt.Sprintf(logoutURLv3, server), bearerToken, nil)
+	}
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if err != nil {
+		logrus.Warnf("Unable to log out the login session: %s", err)
+	}
+}
+
+// doBearerRequest sends a JSON request authenticated with bearerToken.
+func doBearerRequest(client *http.Client, method, url, bearerToken string, body []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return doRequest(client, req)
+}
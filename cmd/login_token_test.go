@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		v3Status      int
+		extStatus     int
+		expectedToken string
+		expectedErr   string
+	}{
+		{
+			name:          "v3 token",
+			v3Status:      http.StatusCreated,
+			expectedToken: "token-abcde:v3-secret",
+		},
+		{
+			name:          "fallback to ext token",
+			v3Status:      http.StatusNotFound,
+			extStatus:     http.StatusCreated,
+			expectedToken: "ext/token-fghij:ext-secret",
+		},
+		{
+			name:        "v3 error",
+			v3Status:    http.StatusForbidden,
+			expectedErr: "error creating API token: 403 Forbidden",
+		},
+		{
+			name:        "ext error",
+			v3Status:    http.StatusNotFound,
+			extStatus:   http.StatusUnauthorized,
+			expectedErr: "error creating API token: 401 Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "Bearer token-session:session-secret", r.Header.Get("Authorization"))
+
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				var req map[string]any
+				require.NoError(t, json.Unmarshal(body, &req))
+
+				switch r.URL.Path {
+				case "/v3/tokens":
+					assert.Equal(t, "Rancher CLI", req["description"])
+					assert.Equal(t, float64(3600000), req["ttl"])
+					assert.Equal(t, "c-12345", req["clusterId"])
+					w.WriteHeader(tt.v3Status)
+					_, _ = w.Write([]byte(`{"type":"token","token":"token-abcde:v3-secret"}`))
+				case "/apis/ext.cattle.io/v1/tokens":
+					assert.Equal(t, "Token", req["kind"])
+					spec, _ := req["spec"].(map[string]any)
+					assert.Equal(t, float64(3600000), spec["ttl"])
+					assert.Equal(t, "c-12345", spec["clusterName"])
+					w.WriteHeader(tt.extStatus)
+					_, _ = w.Write([]byte(`{"apiVersion":"ext.cattle.io/v1","kind":"Token","status":{"bearerToken":"ext/token-fghij:ext-secret"}}`))
+				default:
+					t.Errorf("unexpected request to %s", r.URL.Path)
+				}
+			}))
+			defer server.Close()
+
+			spec := apiTokenSpec{Description: "Rancher CLI", TTL: time.Hour, ClusterID: "c-12345"}
+			token, err := createAPIToken(server.Client(), server.URL, "token-session:session-secret", spec)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedToken, token.BearerToken)
+		})
+	}
+}
+
+func TestLogoutSession(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		bearerToken    string
+		expectedMethod string
+		expectedURI    string
+	}{
+		{
+			name:           "v3 session",
+			bearerToken:    "token-session:session-secret",
+			expectedMethod: http.MethodPost,
+			expectedURI:    "/v3/tokens?action=logout",
+		},
+		{
+			name:           "ext session",
+			bearerToken:    "ext/token-session:session-secret",
+			expectedMethod: http.MethodDelete,
+			expectedURI:    "/apis/ext.cattle.io/v1/tokens/token-session",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var called bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				assert.Equal(t, tt.expectedMethod, r.Method)
+				assert.Equal(t, tt.expectedURI, r.URL.RequestURI())
+				assert.Equal(t, "Bearer "+tt.bearerToken, r.Header.Get("Authorization"))
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			logoutSession(server.Client(), server.URL, tt.bearerToken)
+			assert.True(t, called)
+		})
+	}
+}
+
+func TestLoginResponseType(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "kubeconfig", (&LoginInput{}).loginResponseType())
+	assert.Equal(t, "kubeconfig_c-12345", (&LoginInput{clusterID: "c-12345"}).loginResponseType())
+	assert.Equal(t, "json", (&LoginInput{clusterID: "c-12345", responseType: "json"}).loginResponseType())
+}
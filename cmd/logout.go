@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rancher/cli/config"
+	"github.com/rancher/norman/clientbase"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+)
+
+const logoutDescription = `
+Logs out of a Rancher server: the API token of the server and the kubeconfig
+tokens cached for it are revoked on the server, then the server and its
+cached kube credentials are removed from the local config. The server is the current server when not given.
+
+Tokens that can't be revoked, for example because they already expired, are
+reported and the server is removed from the local config anyway.
+
+Example:
+	# Log out of the current server
+	$ rancher logout
+
+	# Log out of the server named staging
+	$ rancher logout staging
+`
+
+// LogoutCommand defines the 'rancher logout' command
+func LogoutCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "logout",
+		Usage:       "Logout of a Rancher server and revoke its tokens",
+		Description: logoutDescription,
+		ArgsUsage:   "[SERVER]",
+		Action:      logout,
+	}
+}
+
+// tokenDeleteFunc deletes the token with the given id, authenticating with bearerToken.
+type tokenDeleteFunc func(ctx context.Context, id, bearerToken string) error
+
+// revokedToken is a token found in the config of a server.
+type revokedToken struct {
+	id     string
+	bearer string
+	kind   string
+}
+
+func logout(ctx context.Context, cmd *cli.Command) error {
+	cf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if cf.FromEnvironment() {
+		return config.ErrEnvironmentConfig
+	}
+
+	name := cf.CurrentServerName()
+	if cmd.NArg() > 0 {
+		name = cmd.Args().First()
+	}
+	name, serverConfig := cf.LookupServer(name)
+	if serverConfig == nil {
+		return fmt.Errorf("server %s is not configured", name)
+	}
+
+	client, err := newServerHTTPClient(serverConfig)
+	if err != nil {
+		return err
+	}
+	baseURL, err := serverConfig.EnvironmentURL()
+	if err != nil {
+		return fmt.Errorf("error resolving server base URL: %w", err)
+	}
+	v3Delete := func(ctx context.Context, id, bearerToken string) error {
+		return deleteV3Token(ctx, id, baseURL, bearerToken, client)
+	}
+	extDelete := func(ctx context.Context, id, bearerToken string) error {
+		return deleteExtToken(ctx, id, baseURL, bearerToken, client)
+	}
+
+	apiBearer := ""
+	if serverConfig.AccessKey != "" && serverConfig.SecretKey != "" {
+		apiBearer = serverConfig.AccessKey + ":" + serverConfig.SecretKey
+	}
+
+	creds, err := cf.LoadCredentials()
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, token := range serverTokens(serverConfig, creds.ServerCredentials(serverConfig.URL)) {
+		// a token can always revoke itself, the API token can revoke the
+		// other tokens of the user if the token itself is not accepted
+		bearers := slices.Compact([]string{token.bearer, apiBearer})
+		revoked, err := revokeToken(ctx, token.id, bearers, v3Delete, extDelete)
+		switch {
+		case err != nil:
+			failed++
+			logrus.Warnf("Unable to revoke %s token %s: %s", token.kind, token.id, err)
+		case revoked:
+			logrus.Infof("Revoked %s token %s", token.kind, token.id)
+		default:
+			logrus.Infof("The %s token %s was already revoked", token.kind, token.id)
+		}
+	}
+
+	err = config.Update(cf.Path, func(cf *config.Config) error {
+		delete(cf.Servers, name)
+		if cf.CurrentServer == name {
+			cf.CurrentServer = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Server %s removed from the local config", name)
+
+	err = cf.UpdateCredentials(func(s *config.CredentialStore) error {
+		for key := range s.ServerCredentials(serverConfig.URL) {
+			s.Delete(serverConfig.URL, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d token(s) could not be revoked, delete them in the Rancher UI", failed)
+	}
+	return nil
+}
+
+// serverTokens returns the tokens stored for the server and the kube
+// credentials cached for it: the kubeconfig tokens first, then the API token,
+// which is used to revoke the other ones.
+func serverTokens(serverConfig *config.ServerConfig, creds map[string]*config.ExecCredential) []revokedToken {
+	var (
+		tokens []revokedToken
+		seen   = make(map[string]bool)
+	)
+	add := func(bearer, kind string) {
+		id, _, ok := strings.Cut(bearer, ":")
+		if !ok || id == "" || seen[id] {
+			return
+		}
+		seen[id] = true
+		tokens = append(tokens, revokedToken{id: id, bearer: bearer, kind: kind})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(creds)) {
+		if cred := creds[key]; cred != nil && cred.Status != nil {
+			add(cred.Status.Token, "kubeconfig")
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(serverConfig.KubeConfigs)) {
+		kubeConfig := serverConfig.KubeConfigs[key]
+		if kubeConfig == nil {
+			continue
+		}
+		for _, authName := range slices.Sorted(maps.Keys(kubeConfig.AuthInfos)) {
+			if authInfo := kubeConfig.AuthInfos[authName]; authInfo != nil {
+				add(authInfo.Token, "kubeconfig")
+			}
+		}
+	}
+	if serverConfig.AccessKey != "" && serverConfig.SecretKey != "" {
+		add(serverConfig.AccessKey+":"+serverConfig.SecretKey, "API")
+	}
+	return tokens
+}
+
+// revokeToken deletes the token with the given id, trying each bearer token in
+// turn until one is authorized. Like validateToken, it tries the v3 Management
+// API first and falls back to ext.cattle.io/v1, ids prefixed with "ext/"
+// skipping the v3 attempt. It reports false when the token doesn't exist.
+func revokeToken(ctx context.Context, tokenID string, bearers []string, v3Delete, extDelete tokenDeleteFunc) (bool, error) {
+	var err error
+	for _, bearer := range bearers {
+		if bearer == "" {
+			continue
+		}
+		var revoked bool
+		revoked, err = revokeTokenWith(ctx, tokenID, bearer, v3Delete, extDelete)
+		if err == nil || !isUnauthorized(err) {
+			return revoked, err
+		}
+	}
+	if err == nil {
+		err = errors.New("no credentials to authenticate with")
+	}
+	return false, err
+}
+
+func revokeTokenWith(ctx context.Context, tokenID, bearer string, v3Delete, extDelete tokenDeleteFunc) (bool, error) {
+	if !strings.HasPrefix(tokenID, extTokenIDPrefix) {
+		err := v3Delete(ctx, tokenID, bearer)
+		if err == nil {
+			return true, nil
+		}
+		if !clientbase.IsNotFound(err) {
+			return false, err
+		}
+	}
+
+	err := extDelete(ctx, strings.TrimPrefix(tokenID, extTokenIDPrefix), bearer)
+	if err == nil {
+		return true, nil
+	}
+	if clientbase.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// deleteV3Token deletes a token through the v3 Management API. Like
+// getExtToken, it returns an unwrapped *clientbase.APIError on failure.
+func deleteV3Token(ctx context.Context, id, baseURL, bearerToken string, client *http.Client) error {
+	return deleteToken(ctx, strings.TrimRight(baseURL, "/")+"/v3/tokens/"+id, bearerToken, client)
+}
+
+// deleteExtToken deletes a token through the ext.cattle.io/v1 API. Like
+// getExtToken, it returns an unwrapped *clientbase.APIError on failure.
+func deleteExtToken(ctx context.Context, id, baseURL, bearerToken string, client *http.Client) error {
+	id = strings.TrimPrefix(id, extTokenIDPrefix)
+	return deleteToken(ctx, strings.TrimRight(baseURL, "/")+"/apis/ext.cattle.io/v1/tokens/"+id, bearerToken, client)
+}
+
+func deleteToken(ctx context.Context, u, bearerToken string, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return fmt.Errorf("error creating delete token request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, body, err := doRequest(client, req)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	}
+	return newAPIError(resp, u, body)
+}
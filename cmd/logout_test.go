@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestServerTokens(t *testing.T) {
+	t.Parallel()
+
+	serverConfig := &config.ServerConfig{
+		AccessKey: "token-api",
+		SecretKey: "api-secret",
+		KubeConfigs: map[string]*api.Config{
+			"u-abcde_c-12345": {AuthInfos: map[string]*api.AuthInfo{
+				"c-12345": {Token: "kubeconfig-u-abcde:secret"},
+			}},
+			"u-abcde_c-54321": {AuthInfos: map[string]*api.AuthInfo{
+				"c-54321": {Token: "kubeconfig-u-klmno:secret"},
+			}},
+		},
+	}
+
+	creds := map[string]*config.ExecCredential{
+		"u-abcde_c-12345": {Status: &config.ExecCredentialStatus{Token: "kubeconfig-u-abcde:secret"}},
+		"u-abcde_c-67890": {Status: &config.ExecCredentialStatus{Token: "ext/token-fghij:secret"}},
+		"u-abcde_c-empty": nil,
+	}
+
+	assert.Equal(t, []revokedToken{
+		{id: "kubeconfig-u-abcde", bearer: "kubeconfig-u-abcde:secret", kind: "kubeconfig"},
+		{id: "ext/token-fghij", bearer: "ext/token-fghij:secret", kind: "kubeconfig"},
+		{id: "kubeconfig-u-klmno", bearer: "kubeconfig-u-klmno:secret", kind: "kubeconfig"},
+		{id: "token-api", bearer: "token-api:api-secret", kind: "API"},
+	}, serverTokens(serverConfig, creds))
+}
+
+func TestRevokeToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		tokenID         string
+		bearers         []string
+		responses       map[string]int
+		expectedRevoked bool
+		expectedErr     string
+		expectedCalls   []string
+	}{
+		{
+			name:            "v3 token",
+			tokenID:         "kubeconfig-u-abcde",
+			bearers:         []string{"kubeconfig-u-abcde:secret"},
+			responses:       map[string]int{"/v3/tokens/kubeconfig-u-abcde": http.StatusNoContent},
+			expectedRevoked: true,
+			expectedCalls:   []string{"/v3/tokens/kubeconfig-u-abcde"},
+		},
+		{
+			name:    "fallback to ext token",
+			tokenID: "token-abcde",
+			bearers: []string{"token-abcde:secret"},
+			responses: map[string]int{
+				"/v3/tokens/token-abcde":                    http.StatusNotFound,
+				"/apis/ext.cattle.io/v1/tokens/token-abcde": http.StatusOK,
+			},
+			expectedRevoked: true,
+			expectedCalls:   []string{"/v3/tokens/token-abcde", "/apis/ext.cattle.io/v1/tokens/token-abcde"},
+		},
+		{
+			name:            "ext token skips v3",
+			tokenID:         "ext/token-abcde",
+			bearers:         []string{"ext/token-abcde:secret"},
+			responses:       map[string]int{"/apis/ext.cattle.io/v1/tokens/token-abcde": http.StatusOK},
+			expectedRevoked: true,
+			expectedCalls:   []string{"/apis/ext.cattle.io/v1/tokens/token-abcde"},
+		},
+		{
+			name:    "already revoked",
+			tokenID: "token-abcde",
+			bearers: []string{"token-abcde:secret"},
+			responses: map[string]int{
+				"/v3/tokens/token-abcde":                    http.StatusNotFound,
+				"/apis/ext.cattle.io/v1/tokens/token-abcde": http.StatusNotFound,
+			},
+			expectedCalls: []string{"/v3/tokens/token-abcde", "/apis/ext.cattle.io/v1/tokens/token-abcde"},
+		},
+		{
+			name:    "fallback to the API token",
+			tokenID: "kubeconfig-u-abcde",
+			bearers: []string{"kubeconfig-u-abcde:expired", "token-api:secret"},
+			responses: map[string]int{
+				"/v3/tokens/kubeconfig-u-abcde kubeconfig-u-abcde:expired": http.StatusUnauthorized,
+				"/v3/tokens/kubeconfig-u-abcde token-api:secret":           http.StatusNoContent,
+			},
+			expectedRevoked: true,
+			expectedCalls:   []string{"/v3/tokens/kubeconfig-u-abcde", "/v3/tokens/kubeconfig-u-abcde"},
+		},
+		{
+			name:          "unauthorized",
+			tokenID:       "kubeconfig-u-abcde",
+			bearers:       []string{"kubeconfig-u-abcde:expired", ""},
+			responses:     map[string]int{"/v3/tokens/kubeconfig-u-abcde": http.StatusUnauthorized},
+			expectedErr:   "Bad response statusCode [401]",
+			expectedCalls: []string{"/v3/tokens/kubeconfig-u-abcde"},
+		},
+		{
+			name:        "no credentials",
+			tokenID:     "kubeconfig-u-abcde",
+			bearers:     []string{""},
+			expectedErr: "no credentials to authenticate with",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodDelete, r.Method)
+				calls = append(calls, r.URL.Path)
+
+				bearer := r.Header.Get("Authorization")[len("Bearer "):]
+				if status, ok := tt.responses[r.URL.Path+" "+bearer]; ok {
+					w.WriteHeader(status)
+					return
+				}
+				if status, ok := tt.responses[r.URL.Path]; ok {
+					w.WriteHeader(status)
+					return
+				}
+				t.Errorf("unexpected request to %s", r.URL.Path)
+			}))
+			defer server.Close()
+
+			v3Delete := func(ctx context.Context, id, bearerToken string) error {
+				return deleteV3Token(ctx, id, server.URL, bearerToken, server.Client())
+			}
+			extDelete := func(ctx context.Context, id, bearerToken string) error {
+				return deleteExtToken(ctx, id, server.URL, bearerToken, server.Client())
+			}
+
+			revoked, err := revokeToken(context.Background(), tt.tokenID, tt.bearers, v3Delete, extDelete)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedRevoked, revoked)
+			assert.Equal(t, tt.expectedCalls, calls)
+		})
+	}
+}
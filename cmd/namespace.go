@@ -87,7 +87,7 @@ func namespaceLs(ctx context.Context, cmd *cli.Command) error {
 		var projectNamespaces []clusterClient.Namespace
 
 		for _, namespace := range collection.Data {
-			if namespace.ProjectID == c.UserConfig.Project {
+			if namespace.ProjectID == c.UserConfig.GetCurrentProject() {
 				projectNamespaces = append(projectNamespaces, namespace)
 			}
 
@@ -127,7 +127,7 @@ func namespaceCreate(ctx context.Context, cmd *cli.Command) error {
 
 	newNamespace := &clusterClient.Namespace{
 		Name:        cmd.Args().First(),
-		ProjectID:   c.UserConfig.Project,
+		ProjectID:   c.UserConfig.GetCurrentProject(),
 		Description: cmd.String("description"),
 	}
 
@@ -44,10 +44,6 @@ func ProjectCommand() *cli.Command {
 				ArgsUsage:   "[NEWPROJECTNAME...]",
 				Action:      projectCreate,
 				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "cluster",
-						Usage: "Cluster ID to create the project in",
-					},
 					&cli.StringFlag{
 						Name:  "description",
 						Usage: "Description to apply to the project",
@@ -165,18 +161,10 @@ func projectCreate(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	clusterID := c.UserConfig.GetCurrentCluster()
-	if cmd.String("cluster") != "" {
-		resource, err := Lookup(c, cmd.String("cluster"), "cluster")
-		if err != nil {
-			return err
-		}
-		clusterID = resource.ID
-	}
-
+	// the cluster of the current context, or the one selected with --cluster
 	newProj := &managementClient.Project{
 		Name:        cmd.Args().First(),
-		ClusterID:   clusterID,
+		ClusterID:   c.UserConfig.GetCurrentCluster(),
 		Description: cmd.String("description"),
 	}
 
@@ -236,7 +224,7 @@ func addProjectMemberRoles(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	projectID := c.UserConfig.Project
+	projectID := c.UserConfig.GetCurrentProject()
 	if cmd.String("project-id") != "" {
 		projectID = cmd.String("project-id")
 	}
@@ -278,7 +266,7 @@ func deleteProjectMemberRoles(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	projectID := c.UserConfig.Project
+	projectID := c.UserConfig.GetCurrentProject()
 	if cmd.String("project-id") != "" {
 		projectID = cmd.String("project-id")
 	}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+)
+
+const proxyDescription = `
+Starts a local HTTP server proxying the Kubernetes API of a cluster through the
+Rancher server, authenticated with the token of the current server. Like
+'kubectl proxy', it lets tools that can't use kubeconfig exec plugins reach
+the cluster, without a kubeconfig. Port-forward upgrades are proxied too, the
+exec and attach requests of pods are rejected unless --allow-exec is given, as
+kubectl proxy does. The impersonation headers of the requests are dropped.
+
+The server only listens on a loopback address and accepts requests for
+localhost. Listening on another address with --address requires --allow-remote,
+anyone reaching the proxy then getting the access of the token to the cluster.
+
+Example:
+	$ rancher proxy --cluster downstream --port 8001
+	$ curl http://localhost:8001/api/v1/namespaces
+`
+
+// proxyShutdownTimeout is how long the proxied requests are given to complete
+// when the proxy is stopped.
+const proxyShutdownTimeout = 5 * time.Second
+
+// proxyRejectPaths are the paths rejected by default, those of kubectl proxy:
+// exec and attach would run commands in the pods of any page reaching the
+// proxy.
+var proxyRejectPaths = []*regexp.Regexp{
+	regexp.MustCompile(`^/api/.*/pods/.*/exec`),
+	regexp.MustCompile(`^/api/.*/pods/.*/attach`),
+}
+
+func ProxyCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "proxy",
+		Usage:       "Run a local proxy to the Kubernetes API of a cluster",
+		Description: proxyDescription,
+		Action:      runProxy,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "port",
+				Usage: "Port to listen on, 0 for a random port",
+				Value: 8001,
+			},
+			&cli.StringFlag{
+				Name:  "address",
+				Usage: "Address to listen on",
+				Value: "127.0.0.1",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-remote",
+				Usage: "Allow listening on a non-loopback address, accepting requests for any host",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-exec",
+				Usage: "Proxy the exec and attach requests of pods, rejected by default",
+			},
+		},
+	}
+}
+
+func runProxy(ctx context.Context, cmd *cli.Command) error {
+	if cmd.NArg() > 0 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	address := cmd.String("address")
+	loopback := address == "localhost"
+	if ip := net.ParseIP(address); ip != nil && ip.IsLoopback() {
+		loopback = true
+	}
+	if !loopback && !cmd.Bool("allow-remote") {
+		return fmt.Errorf("refusing to listen on the non-loopback address %s, use --allow-remote", address)
+	}
+
+	tokenAPI, err := newServerTokenAPI(cmd)
+	if err != nil {
+		return err
+	}
+
+	clusterID := tokenAPI.serverConfig.GetCurrentCluster()
+	if configOverrides(cmd).Cluster != "" {
+		// the client resolves the cluster name of --cluster
+		c, err := GetClient(cmd)
+		if err != nil {
+			return err
+		}
+		clusterID = c.UserConfig.GetCurrentCluster()
+	}
+	if clusterID == "" {
+		return errors.New("no cluster selected, use --cluster or run `rancher context switch`")
+	}
+
+	target, err := url.Parse(tokenAPI.serverConfig.URL + "/k8s/clusters/" + clusterID)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(cmd.Int("port"))))
+	if err != nil {
+		return err
+	}
+
+	var acceptHosts []string
+	if loopback {
+		acceptHosts = []string{"localhost", "127.0.0.1", "::1"}
+	} else {
+		logrus.Warnf("Listening on %s, anyone reaching it gets the access of your token to the cluster [%s]", listener.Addr(), clusterID)
+	}
+	rejectPaths := proxyRejectPaths
+	if cmd.Bool("allow-exec") {
+		rejectPaths = nil
+	}
+	server := &http.Server{
+		// the client timeout of newHTTPClient isn't kept, watches and
+		// upgraded connections last
+		Handler:           newClusterProxy(target, tokenAPI.bearerToken, tokenAPI.client.Transport, acceptHosts, rejectPaths),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), proxyShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	customPrint(fmt.Sprintf("Starting to serve cluster [%s] on %s", clusterID, listener.Addr()))
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newClusterProxy returns a handler proxying the requests to target with the
+// bearer token, replacing the credentials and dropping the impersonation
+// headers of the requests. Upgraded connections, used by exec, attach and
+// port-forward, are proxied too. If acceptHosts isn't empty, the requests for
+// other hosts are rejected, against DNS rebinding. The requests for a path
+// matching rejectPaths are rejected.
+func newClusterProxy(target *url.URL, bearerToken string, transport http.RoundTripper, acceptHosts []string, rejectPaths []*regexp.Regexp) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			for name := range r.Out.Header {
+				if strings.HasPrefix(name, "Impersonate-") {
+					r.Out.Header.Del(name)
+				}
+			}
+			r.Out.Header.Set("Authorization", "Bearer "+bearerToken)
+			r.Out.Header.Del("Cookie")
+		},
+		Transport: transport,
+		// stream watches and logs as they come
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logrus.Errorf("Error proxying %s %s: %s", r.Method, r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(acceptHosts) > 0 {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = h
+			}
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+			if !slices.Contains(acceptHosts, host) {
+				http.Error(w, "host not accepted", http.StatusForbidden)
+				return
+			}
+		}
+		for _, rejectPath := range rejectPaths {
+			if rejectPath.MatchString(r.URL.Path) {
+				http.Error(w, "path not accepted, use --allow-exec", http.StatusForbidden)
+				return
+			}
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
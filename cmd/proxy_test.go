@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rancher/cli/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterProxy(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/k8s/clusters/c-12345/api/v1/namespaces", r.URL.Path)
+		assert.Equal(t, "watch=true", r.URL.RawQuery)
+		assert.Equal(t, "Bearer token-abcde:secret", r.Header.Get("Authorization"))
+		assert.Empty(t, r.Header.Get("Cookie"))
+		assert.Empty(t, r.Header.Get("Impersonate-User"))
+		assert.Empty(t, r.Header.Get("Impersonate-Extra-Scopes"))
+		w.Write([]byte(`{"kind":"NamespaceList"}`))
+	}))
+	t.Cleanup(upstream.Close)
+	target, err := url.Parse(upstream.URL + "/k8s/clusters/c-12345")
+	require.NoError(t, err)
+
+	proxy := httptest.NewServer(newClusterProxy(target, "token-abcde:secret", http.DefaultTransport, []string{"localhost", "127.0.0.1", "::1"}, proxyRejectPaths))
+	t.Cleanup(proxy.Close)
+
+	req, err := http.NewRequest(http.MethodGet, proxy.URL+"/api/v1/namespaces?watch=true", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer other")
+	req.Header.Set("Cookie", "R_SESS=other")
+	req.Header.Set("Impersonate-User", "admin")
+	req.Header.Set("Impersonate-Extra-Scopes", "all")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"kind":"NamespaceList"}`, string(body))
+
+	// requests for other hosts are rejected, against DNS rebinding
+	req, err = http.NewRequest(http.MethodGet, proxy.URL+"/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	req.Host = "attacker.example.com"
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// exec and attach are rejected, like kubectl proxy does
+	for _, path := range []string{"/api/v1/namespaces/default/pods/web/exec", "/api/v1/namespaces/default/pods/web/attach"} {
+		resp, err = http.Get(proxy.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, path)
+	}
+}
+
+// newPrivateCAServer starts a TLS server for handler with a certificate signed
+// by a throwaway CA, returned PEM encoded.
+func newPrivateCAServer(t *testing.T, handler http.Handler) (*httptest.Server, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "private-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "rancher"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+}
+
+func TestClusterProxyPrivateCA(t *testing.T) {
+	t.Parallel()
+
+	upstream, caCerts := newPrivateCAServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/k8s/clusters/c-12345/version", r.URL.Path)
+		assert.Equal(t, "Bearer token-abcde:secret", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"major":"1"}`))
+	}))
+
+	// the transport of the proxy trusts the CA of the server config
+	tokenAPI, err := serverTokenAPIFor(&config.ServerConfig{
+		URL:       upstream.URL,
+		AccessKey: "token-abcde",
+		SecretKey: "secret",
+		CACerts:   caCerts,
+	})
+	require.NoError(t, err)
+	target, err := url.Parse(upstream.URL + "/k8s/clusters/c-12345")
+	require.NoError(t, err)
+
+	proxy := httptest.NewServer(newClusterProxy(target, tokenAPI.bearerToken, tokenAPI.client.Transport, nil, nil))
+	t.Cleanup(proxy.Close)
+
+	resp, err := http.Get(proxy.URL + "/version")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"major":"1"}`, string(body))
+
+	// without the CA, the certificate of the server isn't trusted
+	proxy = httptest.NewServer(newClusterProxy(target, tokenAPI.bearerToken, http.DefaultTransport, nil, nil))
+	t.Cleanup(proxy.Close)
+
+	resp, err = http.Get(proxy.URL + "/version")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestClusterProxyUpgrade(t *testing.T) {
+	t.Parallel()
+
+	// an upstream switching to an echo protocol, like the SPDY and websocket
+	// streams of exec and port-forward
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token-abcde:secret", r.Header.Get("Authorization"))
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	}))
+	t.Cleanup(upstream.Close)
+	target, err := url.Parse(upstream.URL + "/k8s/clusters/c-12345")
+	require.NoError(t, err)
+
+	proxy := httptest.NewServer(newClusterProxy(target, "token-abcde:secret", http.DefaultTransport, nil, nil))
+	t.Cleanup(proxy.Close)
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req, err := http.NewRequest(http.MethodGet, proxy.URL+"/api/v1/namespaces/default/pods/web/exec", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	require.NoError(t, req.Write(conn))
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	echo := make([]byte, 4)
+	_, err = io.ReadFull(r, echo)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(echo))
+}
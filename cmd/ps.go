@@ -62,7 +62,9 @@ func psLs(ctx context.Context, cmd *cli.Command) error {
 		if err != nil {
 			return err
 		}
-		sc.Project = resource.ID
+		if err := sc.OverrideContext(resource.ID, ""); err != nil {
+			return err
+		}
 
 		projClient, err := cliclient.NewProjectClient(sc)
 		if err != nil {
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+)
+
+// secretRuntimeDir holds the secret files handed to other commands, in
+// $XDG_RUNTIME_DIR or the config directory.
+const secretRuntimeDir = "runtime"
+
+// secretFiles hands secrets, kubeconfigs or SSH keys, to another command
+// through files only accessible by the user, in a runtime directory rather
+// than the shared temp directory. The files are removed once the command
+// exits or when the CLI is terminated, and the files left behind by killed
+// processes are swept on startup.
+type secretFiles struct {
+	dir string
+	// paths are the files in dir, removed by Remove.
+	paths []string
+	// extraFiles are handed to the command as inherited file descriptors.
+	extraFiles []*os.File
+
+	mu sync.Mutex
+}
+
+// runtimeDir returns the directory holding the secret files of the CLI using
+// the config file of cmd.
+func runtimeDir(cmd *cli.Command) string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "rancher")
+	}
+	return filepath.Join(filepath.Dir(GetConfigPath(cmd)), secretRuntimeDir)
+}
+
+// newSecretFiles returns secretFiles in dir, which is created only
+// accessible by the user if needed.
+func newSecretFiles(dir string) (*secretFiles, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	// MkdirAll keeps the mode of an existing directory
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &secretFiles{dir: dir}, nil
+}
+
+// Add writes content to a new file named after name and returns the path the
+// command opens it by. With inherit, the file is removed right away on Linux
+// and handed to the command as an inherited descriptor, opened through
+// /dev/fd, so that nothing is left behind even if the CLI is killed. It's
+// only suitable for commands opening the file themselves, not spawning other
+// commands opening it, nor closing inherited descriptors like ssh does.
+func (s *secretFiles) Add(name string, content []byte, inherit bool) (string, error) {
+	// the PID in the name tells the sweep whether the file is still in use
+	f, err := os.CreateTemp(s.dir, fmt.Sprintf("%s-%d-*", name, os.Getpid()))
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.paths = append(s.paths, f.Name())
+	s.mu.Unlock()
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return "", err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if !inherit || runtime.GOOS != "linux" {
+		return f.Name(), f.Close()
+	}
+
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.extraFiles = append(s.extraFiles, f)
+	// the extra files are the descriptors following stdin, stdout and stderr
+	return fmt.Sprintf("/dev/fd/%d", 2+len(s.extraFiles)), nil
+}
+
+// Run runs execCmd with the secret files, removing them once it exits. While
+// it runs, an interrupt is left to the command, which gets it from the
+// terminal too, while other termination signals remove the files and are
+// forwarded to the command.
+func (s *secretFiles) Run(execCmd *exec.Cmd) error {
+	defer s.Remove()
+
+	execCmd.ExtraFiles = s.extraFiles
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	if err := execCmd.Start(); err != nil {
+		return err
+	}
+	// the descriptors are now held by the command
+	s.closeExtraFiles()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == os.Interrupt {
+					continue
+				}
+				s.Remove()
+				if err := execCmd.Process.Signal(sig); err != nil {
+					logrus.Debugf("Unable to forward %s to %s: %s", sig, execCmd.Path, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return execCmd.Wait()
+}
+
+// Remove removes the secret files.
+func (s *secretFiles) Remove() {
+	s.closeExtraFiles()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range s.paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.Warnf("Unable to remove %s: %s", path, err)
+		}
+	}
+	s.paths = nil
+}
+
+func (s *secretFiles) closeExtraFiles() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.extraFiles {
+		f.Close()
+	}
+	s.extraFiles = nil
+}
+
+// SweepSecretFiles removes the secret files left behind in the runtime
+// directory by CLI processes that are gone, like killed ones.
+func SweepSecretFiles(cmd *cli.Command) {
+	sweepSecretFiles(runtimeDir(cmd), processAlive)
+}
+
+func sweepSecretFiles(dir string, alive func(pid int) bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Debugf("Unable to sweep the secret files: %s", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		// the names are <name>-<pid>-<random>
+		parts := strings.Split(entry.Name(), "-")
+		if len(parts) < 3 {
+			continue
+		}
+		pid, err := strconv.Atoi(parts[len(parts)-2])
+		if err != nil || alive(pid) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := os.Remove(path); err != nil {
+			logrus.Debugf("Unable to remove the stale secret file %s: %s", path, err)
+		}
+	}
+}
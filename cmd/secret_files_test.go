@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "runtime")
+	secrets, err := newSecretFiles(dir)
+	require.NoError(t, err)
+
+	path, err := secrets.Add("ssh", []byte("private key"), false)
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(path))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "private key", string(content))
+
+	secrets.Remove()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSweepSecretFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"kubeconfig-100-123456", "ssh-200-123456", "kubeconfig-300-123456", "other"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	sweepSecretFiles(dir, func(pid int) bool { return pid == 200 })
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"other", "ssh-200-123456"}, names)
+
+	// the running process is alive
+	assert.True(t, processAlive(os.Getpid()))
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether the process with the given PID is running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"syscall"
+)
+
+// processAlive reports whether the process with the given PID is running.
+func processAlive(pid int) bool {
+	const processQueryLimitedInformation = 0x1000
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	const stillActive = 259
+	return syscall.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
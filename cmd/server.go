@@ -95,7 +95,7 @@ be displayed and one can be selected.
 
 // serverCurrent command to display the name of the current server in the local config
 func serverCurrent(out io.Writer, cfg *config.Config) error {
-	serverName := cfg.CurrentServer
+	serverName := cfg.CurrentServerName()
 
 	currentServer, found := cfg.Servers[serverName]
 	if !found {
@@ -244,7 +244,7 @@ func getServers(cfg *config.Config) []*serverData {
 
 	for i, server := range serverNames {
 		var current string
-		if server == cfg.CurrentServer {
+		if server == cfg.CurrentServerName() {
 			current = "*"
 		}
 
@@ -95,7 +95,7 @@ func nodeSSH(ctx context.Context, cmd *cli.Command) error {
 		ipAddress = sshNode.ExternalIPAddress
 	}
 
-	return processExitCode(callSSH(key, ipAddress, user, args))
+	return processExitCode(callSSH(runtimeDir(cmd), key, ipAddress, user, args))
 }
 
 func getNodeAndKey(cmd *cli.Command, c *cliclient.MasterClient, nodeName string) (managementClient.Node, []byte, string, error) {
@@ -129,33 +129,27 @@ func getNodeAndKey(cmd *cli.Command, c *cliclient.MasterClient, nodeName string)
 	return sshNode, key, sshUser, nil
 }
 
-func callSSH(content []byte, ip string, user string, args []string) error {
+// callSSH runs ssh with the private key in a secret file of secretsDir. ssh
+// closes the inherited descriptors, so the key is written to a file removed
+// once ssh exits.
+func callSSH(secretsDir string, content []byte, ip string, user string, args []string) error {
 	dest := fmt.Sprintf("%s@%s", user, ip)
 
-	tmpfile, err := os.CreateTemp("", "ssh")
+	secrets, err := newSecretFiles(secretsDir)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(tmpfile.Name())
-
-	if err := os.Chmod(tmpfile.Name(), 0600); err != nil {
-		return err
-	}
-
-	_, err = tmpfile.Write(content)
+	keyPath, err := secrets.Add("ssh", content, false)
 	if err != nil {
+		secrets.Remove()
 		return err
 	}
 
-	if err := tmpfile.Close(); err != nil {
-		return err
-	}
-
-	cmd := exec.Command("ssh", append([]string{"-i", tmpfile.Name(), dest}, args...)...)
+	cmd := exec.Command("ssh", append([]string{"-i", keyPath, dest}, args...)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return secrets.Run(cmd)
 }
 
 func getSSHKey(c *cliclient.MasterClient, link, nodeName string) ([]byte, string, error) {
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/rancher/norman/clientbase"
 	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
 	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/sirupsen/logrus"
 )
 
 // loginToken holds the fields extracted from a basic/OAuth login response,
@@ -96,15 +98,7 @@ func getExtToken(ctx context.Context, id, baseURL, bearerToken string, client *h
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		// doRequest has already drained and closed resp.Body, so build the APIError
-		// directly rather than calling clientbase.NewAPIError which would read a closed body.
-		return nil, &clientbase.APIError{
-			StatusCode: resp.StatusCode,
-			URL:        u,
-			Status:     resp.Status,
-			Msg:        fmt.Sprintf("Bad response statusCode [%d]. Status [%s]. URL [%s]", resp.StatusCode, resp.Status, u),
-			Body:       string(body),
-		}
+		return nil, newAPIError(resp, u, body)
 	}
 
 	var t extv1.Token
@@ -114,6 +108,33 @@ func getExtToken(ctx context.Context, id, baseURL, bearerToken string, client *h
 	return &t, nil
 }
 
+// listExtTokens lists the tokens of the user from the ext.cattle.io/v1 API.
+// Like getExtToken, it returns an unwrapped *clientbase.APIError on failure.
+func listExtTokens(ctx context.Context, baseURL, bearerToken string, client *http.Client) ([]extv1.Token, error) {
+	u := strings.TrimRight(baseURL, "/") + "/apis/ext.cattle.io/v1/tokens"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ext token request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, body, err := doRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, u, body)
+	}
+
+	var list extv1.TokenList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ext tokens: %w", err)
+	}
+	return list.Items, nil
+}
+
 // getTokenUserID returns the user id associated with the given token id.
 // It tries the v3 Management API first and falls back to ext.cattle.io/v1.
 // Ids prefixed with "ext/" skip the v3 attempt entirely. The prefix is stripped
@@ -136,18 +157,75 @@ func getTokenUserID(ctx context.Context, tokenID string, v3ByID tokenByIDFunc, e
 	return extToken.Spec.UserID, nil
 }
 
+// tokenDetails holds the fields of a token describing the identity behind it,
+// normalizing v3 Norman tokens and ext.cattle.io/v1 Tokens to a single type.
+type tokenDetails struct {
+	UserID          string
+	AuthProvider    string
+	UserPrincipal   string
+	GroupPrincipals []string
+	ExpiresAt       string
+	Expired         bool
+	// TTL is the lifetime the token was created with, 0 when it doesn't expire.
+	TTL time.Duration
+}
+
+// getTokenDetails returns the details of the token with the given id. Like
+// getTokenUserID, it tries the v3 Management API first and falls back to
+// ext.cattle.io/v1, ids prefixed with "ext/" skipping the v3 attempt.
+func getTokenDetails(ctx context.Context, tokenID string, v3ByID tokenByIDFunc, extGetter extTokenGetterFunc) (tokenDetails, error) {
+	if !strings.HasPrefix(tokenID, extTokenIDPrefix) {
+		token, err := v3ByID(tokenID)
+		if err == nil {
+			return tokenDetails{
+				UserID:          token.UserID,
+				AuthProvider:    token.AuthProvider,
+				UserPrincipal:   token.UserPrincipal,
+				GroupPrincipals: token.GroupPrincipals,
+				ExpiresAt:       token.ExpiresAt,
+				Expired:         token.Expired,
+				TTL:             time.Duration(token.TTLMillis) * time.Millisecond,
+			}, nil
+		}
+		if !clientbase.IsNotFound(err) {
+			return tokenDetails{}, err
+		}
+	}
+
+	extToken, err := extGetter(ctx, strings.TrimPrefix(tokenID, extTokenIDPrefix))
+	if err != nil {
+		return tokenDetails{}, fmt.Errorf("error resolving token %q: %w", tokenID, err)
+	}
+	return tokenDetails{
+		UserID:          extToken.Spec.UserID,
+		AuthProvider:    extToken.Status.AuthProvider,
+		UserPrincipal:   extToken.Status.PrincipalID,
+		GroupPrincipals: extToken.Status.GroupPrincipals,
+		ExpiresAt:       extToken.Status.ExpiresAt,
+		Expired:         extToken.Status.Expired,
+		TTL:             time.Duration(extToken.Spec.TTL) * time.Millisecond,
+	}, nil
+}
+
 // validateToken reports whether the token with the given id exists and is not expired.
 // It tries the v3 Management API first and falls back to ext.cattle.io/v1.
 // Ids prefixed with "ext/" skip the v3 attempt entirely. The prefix is stripped
 // before the ext lookup so callees receive a clean token name.
 func validateToken(ctx context.Context, tokenID string, v3ByID tokenByIDFunc, extGetter extTokenGetterFunc) (bool, error) {
+	valid, _, err := validateTokenExpiry(ctx, tokenID, v3ByID, extGetter)
+	return valid, err
+}
+
+// validateTokenExpiry is like validateToken, also returning when the token
+// expires, nil if it doesn't.
+func validateTokenExpiry(ctx context.Context, tokenID string, v3ByID tokenByIDFunc, extGetter extTokenGetterFunc) (bool, *time.Time, error) {
 	if !strings.HasPrefix(tokenID, extTokenIDPrefix) {
 		token, err := v3ByID(tokenID)
 		if err == nil {
-			return !token.Expired, nil
+			return !token.Expired, parseTokenExpiry(token.ExpiresAt), nil
 		}
 		if !clientbase.IsNotFound(err) {
-			return false, err
+			return false, nil, err
 		}
 	}
 
@@ -158,11 +236,38 @@ func validateToken(ctx context.Context, tokenID string, v3ByID tokenByIDFunc, ex
 		// server. Fall through to kubeconfig regeneration in either case rather
 		// than surfacing an opaque error to the user.
 		if clientbase.IsNotFound(err) || isUnauthorized(err) {
-			return false, nil
+			return false, nil, nil
 		}
-		return false, err
+		return false, nil, err
+	}
+	return !extToken.Status.Expired, parseTokenExpiry(extToken.Status.ExpiresAt), nil
+}
+
+// parseTokenExpiry parses the RFC 3339 expiry of a token, returning nil for
+// tokens that don't expire.
+func parseTokenExpiry(expiresAt string) *time.Time {
+	if expiresAt == "" {
+		return nil
+	}
+	ts, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		logrus.Debugf("Unable to parse the token expiry %q: %s", expiresAt, err)
+		return nil
+	}
+	return &ts
+}
+
+// newAPIError returns the *clientbase.APIError of a failed request. doRequest
+// has already drained and closed resp.Body, so the APIError is built directly
+// rather than calling clientbase.NewAPIError which would read a closed body.
+func newAPIError(resp *http.Response, u string, body []byte) *clientbase.APIError {
+	return &clientbase.APIError{
+		StatusCode: resp.StatusCode,
+		URL:        u,
+		Status:     resp.Status,
+		Msg:        fmt.Sprintf("Bad response statusCode [%d]. Status [%s]. URL [%s]", resp.StatusCode, resp.Status, u),
+		Body:       string(body),
 	}
-	return !extToken.Status.Expired, nil
 }
 
 // isUnauthorized reports whether err is a *clientbase.APIError with status 401 or 403.
@@ -257,6 +257,32 @@ func TestValidateTokenExtPrefixSkipsV3(t *testing.T) {
 	assert.True(t, ok)
 }
 
+func TestValidateTokenExpiry(t *testing.T) {
+	t.Parallel()
+
+	v3 := func(id string) (*managementClient.Token, error) {
+		if id == "token-abc" {
+			return &managementClient.Token{ExpiresAt: "2026-10-17T12:00:00Z"}, nil
+		}
+		return nil, newNotFound()
+	}
+	ext := func(_ context.Context, _ string) (*extv1.Token, error) {
+		return &extv1.Token{}, nil
+	}
+
+	ok, expiresAt, err := validateTokenExpiry(t.Context(), "token-abc", v3, ext)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NotNil(t, expiresAt)
+	assert.Equal(t, time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), expiresAt.UTC())
+
+	// ext tokens without an expiry don't expire
+	ok, expiresAt, err = validateTokenExpiry(t.Context(), "token-def", v3, ext)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, expiresAt)
+}
+
 func TestValidateTokenV3NotFoundExtUnauthorized(t *testing.T) {
 	t.Parallel()
 
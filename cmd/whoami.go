@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rancher/norman/types"
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v3"
+)
+
+// WhoamiData is the identity behind the API token of the current server.
+type WhoamiData struct {
+	UserID          string       `json:"userId"`
+	Username        string       `json:"username,omitempty"`
+	Name            string       `json:"name,omitempty"`
+	Provider        string       `json:"provider,omitempty"`
+	PrincipalID     string       `json:"principalId,omitempty"`
+	GroupPrincipals []string     `json:"groupPrincipals"`
+	GlobalRoles     []WhoamiRole `json:"globalRoles"`
+	Token           WhoamiToken  `json:"token"`
+	ClusterID       string       `json:"clusterId,omitempty"`
+	ClusterRoles    []WhoamiRole `json:"clusterRoles,omitempty"`
+	ProjectID       string       `json:"projectId,omitempty"`
+	ProjectRoles    []WhoamiRole `json:"projectRoles,omitempty"`
+	Unavailable     []string     `json:"unavailable,omitempty"`
+}
+
+// WhoamiRole is a role bound to the user, directly or through one of its
+// groups.
+type WhoamiRole struct {
+	Role string `json:"role"`
+	// Group is the group principal the role is bound to, empty when the
+	// role is bound to the user.
+	Group string `json:"group,omitempty"`
+}
+
+// WhoamiToken is the API token of the current server.
+type WhoamiToken struct {
+	ID        string     `json:"id"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Expired   bool       `json:"expired"`
+	TTL       string     `json:"ttl"`
+	Remaining string     `json:"remaining"`
+}
+
+type userGetter interface {
+	ByID(id string) (*managementClient.User, error)
+}
+
+type grbLister interface {
+	List(opts *types.ListOpts) (*managementClient.GlobalRoleBindingCollection, error)
+}
+
+// whoamiClients are the APIs the identity of the user is read from.
+type whoamiClients struct {
+	users userGetter
+	grbs  grbLister
+	crtbs crtbLister
+	prtbs prtbLister
+}
+
+// bindingSubject matches the role bindings of the user or of one of its
+// groups.
+type bindingSubject struct {
+	field string
+	value string
+	group string
+}
+
+func WhoamiCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "whoami",
+		Usage: "Display the user, groups and roles of the current server and context",
+		Description: "Displays the user behind the API token of the current server, its auth provider, group principals, " +
+			"global roles and the expiry of the token, then the roles bound to the user and its groups in the current " +
+			"cluster and project.",
+		Action: whoami,
+		Flags: []cli.Flag{
+			formatFlag,
+		},
+	}
+}
+
+func whoami(ctx context.Context, cmd *cli.Command) error {
+	c, err := GetClient(cmd)
+	if err != nil {
+		return err
+	}
+	api, err := newServerTokenAPI(cmd)
+	if err != nil {
+		return err
+	}
+	extGetter := func(ctx context.Context, id string) (*extv1.Token, error) {
+		return getExtToken(ctx, id, api.baseURL, api.bearerToken, api.client)
+	}
+
+	clients := whoamiClients{
+		users: c.ManagementClient.User,
+		grbs:  c.ManagementClient.GlobalRoleBinding,
+		crtbs: c.ManagementClient.ClusterRoleTemplateBinding,
+		prtbs: c.ManagementClient.ProjectRoleTemplateBinding,
+	}
+	data, err := getWhoami(ctx, api.serverConfig.AccessKey, c.ManagementClient.Token.ByID, extGetter, clients, c.UserConfig, time.Now())
+	if err != nil {
+		return err
+	}
+	return writeWhoami(cmd.Root().Writer, data, cmd.String("format"))
+}
+
+// getWhoami resolves the identity behind the token with the given id, and the
+// roles bound to it in the current cluster and project of config. Bindings the
+// user isn't allowed to list are reported as unavailable rather than failing.
+func getWhoami(ctx context.Context, tokenID string, v3ByID tokenByIDFunc, extGetter extTokenGetterFunc, clients whoamiClients, config userConfig, now time.Time) (*WhoamiData, error) {
+	token, err := getTokenDetails(ctx, tokenID, v3ByID, extGetter)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &WhoamiData{
+		UserID:          token.UserID,
+		Provider:        token.AuthProvider,
+		PrincipalID:     token.UserPrincipal,
+		GroupPrincipals: token.GroupPrincipals,
+		Token:           newWhoamiToken(tokenID, token, now),
+		ClusterID:       config.GetCurrentCluster(),
+		ProjectID:       config.GetCurrentProject(),
+	}
+	if data.GroupPrincipals == nil {
+		data.GroupPrincipals = []string{}
+	}
+
+	user, err := clients.users.ByID(token.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user %s: %w", token.UserID, err)
+	}
+	data.Username = user.Username
+	data.Name = user.Name
+	if data.PrincipalID == "" && len(user.PrincipalIDs) > 0 {
+		data.PrincipalID = user.PrincipalIDs[0]
+	}
+
+	subjects := []bindingSubject{{field: "userId", value: token.UserID}}
+	for _, group := range token.GroupPrincipals {
+		subjects = append(subjects, bindingSubject{field: "groupPrincipalId", value: group, group: group})
+	}
+
+	// unavailable records the bindings the user isn't allowed to list, any
+	// other error is returned.
+	unavailable := func(kind string, err error) error {
+		if err == nil || !isUnauthorized(err) {
+			return err
+		}
+		logrus.Debugf("Unable to list the %s role bindings: %s", kind, err)
+		data.Unavailable = append(data.Unavailable, kind+" roles")
+		return nil
+	}
+
+	data.GlobalRoles, err = listBindingRoles(subjects, nil, func(opts *types.ListOpts) ([]string, error) {
+		bindings, err := clients.grbs.List(opts)
+		if err != nil {
+			return nil, err
+		}
+		var roles []string
+		for _, binding := range bindings.Data {
+			roles = append(roles, binding.GlobalRoleID)
+		}
+		return roles, nil
+	})
+	if err := unavailable("global", err); err != nil {
+		return nil, err
+	}
+	if data.GlobalRoles == nil {
+		data.GlobalRoles = []WhoamiRole{}
+	}
+
+	if data.ClusterID != "" {
+		scope := map[string]any{"clusterId": data.ClusterID}
+		data.ClusterRoles, err = listBindingRoles(subjects, scope, func(opts *types.ListOpts) ([]string, error) {
+			bindings, err := clients.crtbs.List(opts)
+			if err != nil {
+				return nil, err
+			}
+			var roles []string
+			for _, binding := range bindings.Data {
+				roles = append(roles, binding.RoleTemplateID)
+			}
+			return roles, nil
+		})
+		if err := unavailable("cluster", err); err != nil {
+			return nil, err
+		}
+	}
+
+	if data.ProjectID != "" {
+		scope := map[string]any{"projectId": data.ProjectID}
+		data.ProjectRoles, err = listBindingRoles(subjects, scope, func(opts *types.ListOpts) ([]string, error) {
+			bindings, err := clients.prtbs.List(opts)
+			if err != nil {
+				return nil, err
+			}
+			var roles []string
+			for _, binding := range bindings.Data {
+				roles = append(roles, binding.RoleTemplateID)
+			}
+			return roles, nil
+		})
+		if err := unavailable("project", err); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// listBindingRoles lists the roles bound to each subject within scope.
+func listBindingRoles(subjects []bindingSubject, scope map[string]any, list func(opts *types.ListOpts) ([]string, error)) ([]WhoamiRole, error) {
+	var roles []WhoamiRole
+	for _, subject := range subjects {
+		opts := baseListOpts()
+		for key, value := range scope {
+			opts.Filters[key] = value
+		}
+		opts.Filters[subject.field] = subject.value
+
+		roleIDs, err := list(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, roleID := range roleIDs {
+			roles = append(roles, WhoamiRole{Role: roleID, Group: subject.group})
+		}
+	}
+	return roles, nil
+}
+
+func newWhoamiToken(id string, token tokenDetails, now time.Time) WhoamiToken {
+	data := WhoamiToken{
+		ID:        id,
+		Expired:   token.Expired,
+		TTL:       "none",
+		Remaining: "-",
+	}
+	if token.TTL > 0 {
+		data.TTL = token.TTL.String()
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt); err == nil {
+		data.ExpiresAt = &expiresAt
+		if remaining := expiresAt.Sub(now); remaining > 0 {
+			data.Remaining = remaining.Round(time.Second).String()
+		} else {
+			data.Expired = true
+		}
+	}
+	if data.Expired {
+		data.Remaining = "expired"
+	}
+	return data
+}
+
+// writeWhoami writes the identity of the user, as a list of fields unless
+// another format is requested.
+func writeWhoami(out io.Writer, data *WhoamiData, format string) error {
+	if format != "" {
+		writer := NewTableWriterWithConfig(nil, &TableWriterConfig{
+			Writer: out,
+			Format: format,
+		})
+		defer writer.Close()
+		writer.Write(data)
+		return writer.Err()
+	}
+
+	user := data.Username
+	if data.Name != "" && data.Name != data.Username {
+		user = fmt.Sprintf("%s (%s)", data.Username, data.Name)
+	}
+	expires := "never"
+	if data.Token.ExpiresAt != nil {
+		expires = data.Token.ExpiresAt.Local().Format(time.RFC3339)
+		if !data.Token.Expired {
+			expires += fmt.Sprintf(" (%s left)", data.Token.Remaining)
+		}
+	}
+	if data.Token.Expired {
+		expires += ", expired"
+	}
+
+	w := tabwriter.NewWriter(out, 10, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "User:\t%s\n", user)
+	fmt.Fprintf(w, "User ID:\t%s\n", data.UserID)
+	fmt.Fprintf(w, "Provider:\t%s\n", valueOrNone(data.Provider))
+	fmt.Fprintf(w, "Principal:\t%s\n", valueOrNone(data.PrincipalID))
+	fmt.Fprintf(w, "Groups:\t%s\n", valueOrNone(strings.Join(data.GroupPrincipals, ", ")))
+	fmt.Fprintf(w, "Global roles:\t%s\n", formatWhoamiRoles(data.GlobalRoles))
+	fmt.Fprintf(w, "Token:\t%s\n", data.Token.ID)
+	fmt.Fprintf(w, "Token expires:\t%s\n", expires)
+	fmt.Fprintf(w, "Token TTL:\t%s\n", data.Token.TTL)
+	if data.ClusterID != "" {
+		fmt.Fprintf(w, "Cluster:\t%s\n", data.ClusterID)
+		fmt.Fprintf(w, "Cluster roles:\t%s\n", formatWhoamiRoles(data.ClusterRoles))
+	}
+	if data.ProjectID != "" {
+		fmt.Fprintf(w, "Project:\t%s\n", data.ProjectID)
+		fmt.Fprintf(w, "Project roles:\t%s\n", formatWhoamiRoles(data.ProjectRoles))
+	}
+	if len(data.Unavailable) > 0 {
+		fmt.Fprintf(w, "Not allowed to list:\t%s\n", strings.Join(data.Unavailable, ", "))
+	}
+	return w.Flush()
+}
+
+func formatWhoamiRoles(roles []WhoamiRole) string {
+	var formatted []string
+	for _, role := range roles {
+		if role.Group != "" {
+			formatted = append(formatted, fmt.Sprintf("%s (via %s)", role.Role, role.Group))
+		} else {
+			formatted = append(formatted, role.Role)
+		}
+	}
+	return valueOrNone(strings.Join(formatted, ", "))
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rancher/norman/clientbase"
+	"github.com/rancher/norman/types"
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWhoamiClients(t *testing.T, crtbErr error) whoamiClients {
+	t.Helper()
+
+	return whoamiClients{
+		users: &fakeUserGetter{ByIDFunc: func(id string) (*managementClient.User, error) {
+			assert.Equal(t, "u-abcde", id)
+			return &managementClient.User{Username: "jdoe", Name: "Jane Doe", PrincipalIDs: []string{"local://u-abcde"}}, nil
+		}},
+		grbs: &fakeGRBLister{ListFunc: func(opts *types.ListOpts) (*managementClient.GlobalRoleBindingCollection, error) {
+			if opts.Filters["userId"] == "u-abcde" {
+				return &managementClient.GlobalRoleBindingCollection{Data: []managementClient.GlobalRoleBinding{{GlobalRoleID: "user"}}}, nil
+			}
+			assert.Equal(t, "github_team://42", opts.Filters["groupPrincipalId"])
+			return &managementClient.GlobalRoleBindingCollection{Data: []managementClient.GlobalRoleBinding{{GlobalRoleID: "restricted-admin"}}}, nil
+		}},
+		crtbs: &fakeCRTBLister{ListFunc: func(opts *types.ListOpts) (*managementClient.ClusterRoleTemplateBindingCollection, error) {
+			if crtbErr != nil {
+				return nil, crtbErr
+			}
+			assert.Equal(t, "c-12345", opts.Filters["clusterId"])
+			if opts.Filters["userId"] == "u-abcde" {
+				return &managementClient.ClusterRoleTemplateBindingCollection{}, nil
+			}
+			return &managementClient.ClusterRoleTemplateBindingCollection{Data: []managementClient.ClusterRoleTemplateBinding{{RoleTemplateID: "cluster-member"}}}, nil
+		}},
+		prtbs: &fakePRTBLister{ListFunc: func(opts *types.ListOpts) (*managementClient.ProjectRoleTemplateBindingCollection, error) {
+			assert.Equal(t, "c-12345:p-12345", opts.Filters["projectId"])
+			if opts.Filters["userId"] == "u-abcde" {
+				return &managementClient.ProjectRoleTemplateBindingCollection{Data: []managementClient.ProjectRoleTemplateBinding{{RoleTemplateID: "project-owner"}}}, nil
+			}
+			return &managementClient.ProjectRoleTemplateBindingCollection{}, nil
+		}},
+	}
+}
+
+func TestGetWhoami(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	v3ByID := func(id string) (*managementClient.Token, error) {
+		assert.Equal(t, "token-abcde", id)
+		return &managementClient.Token{
+			UserID:          "u-abcde",
+			AuthProvider:    "github",
+			UserPrincipal:   "github_user://1",
+			GroupPrincipals: []string{"github_team://42"},
+			ExpiresAt:       "2030-01-02T04:34:05Z",
+			TTLMillis:       (2 * time.Hour).Milliseconds(),
+		}, nil
+	}
+	extGetter := func(context.Context, string) (*extv1.Token, error) {
+		t.Error("the ext API is not called for v3 tokens")
+		return nil, nil
+	}
+	config := &fakeUserConfig{
+		GetCurrentClusterFunc: func() string { return "c-12345" },
+		GetCurrentProjectFunc: func() string { return "c-12345:p-12345" },
+	}
+
+	data, err := getWhoami(context.Background(), "token-abcde", v3ByID, extGetter, newWhoamiClients(t, nil), config, now)
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe", data.Username)
+	assert.Equal(t, "github", data.Provider)
+	assert.Equal(t, "github_user://1", data.PrincipalID)
+	assert.Equal(t, []string{"github_team://42"}, data.GroupPrincipals)
+	assert.Equal(t, []WhoamiRole{{Role: "user"}, {Role: "restricted-admin", Group: "github_team://42"}}, data.GlobalRoles)
+	assert.Equal(t, []WhoamiRole{{Role: "cluster-member", Group: "github_team://42"}}, data.ClusterRoles)
+	assert.Equal(t, []WhoamiRole{{Role: "project-owner"}}, data.ProjectRoles)
+	assert.Equal(t, "2h0m0s", data.Token.TTL)
+	assert.Equal(t, "1h30m0s", data.Token.Remaining)
+	assert.False(t, data.Token.Expired)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, writeWhoami(out, data, ""))
+	assert.Contains(t, out.String(), "User:            jdoe (Jane Doe)\n")
+	assert.Contains(t, out.String(), "Global roles:    user, restricted-admin (via github_team://42)\n")
+	assert.Contains(t, out.String(), "Project roles:   project-owner\n")
+
+	out.Reset()
+	require.NoError(t, writeWhoami(out, data, "json"))
+	assert.Contains(t, out.String(), `"clusterRoles":[{"role":"cluster-member","group":"github_team://42"}]`)
+}
+
+func TestGetWhoamiExtToken(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	v3ByID := func(string) (*managementClient.Token, error) {
+		t.Error("the v3 API is not called for ext tokens")
+		return nil, nil
+	}
+	extGetter := func(_ context.Context, id string) (*extv1.Token, error) {
+		assert.Equal(t, "token-fghij", id)
+		return &extv1.Token{
+			Spec:   extv1.TokenSpec{UserID: "u-abcde"},
+			Status: extv1.TokenStatus{AuthProvider: "local", ExpiresAt: "2030-01-01T00:00:00Z"},
+		}, nil
+	}
+	forbidden := &clientbase.APIError{StatusCode: http.StatusForbidden}
+	config := &fakeUserConfig{GetCurrentClusterFunc: func() string { return "c-12345" }}
+
+	data, err := getWhoami(context.Background(), "ext/token-fghij", v3ByID, extGetter, newWhoamiClients(t, forbidden), config, now)
+	require.NoError(t, err)
+	assert.Equal(t, "local://u-abcde", data.PrincipalID)
+	assert.Equal(t, []string{}, data.GroupPrincipals)
+	assert.Equal(t, []WhoamiRole{{Role: "user"}}, data.GlobalRoles)
+	assert.Empty(t, data.ClusterRoles)
+	assert.Equal(t, []string{"cluster roles"}, data.Unavailable)
+	assert.Equal(t, "none", data.Token.TTL)
+	assert.True(t, data.Token.Expired)
+	assert.Equal(t, "expired", data.Token.Remaining)
+}
@@ -19,26 +19,70 @@ var ErrNoConfigurationFound = errors.New("no configuration found, run `login`")
 
 // Config holds the main config for the user
 type Config struct {
+	// Version is the version of the config schema, see migrations
+	Version int `json:"version,omitempty"`
 	// Servers is a map of server configs
 	Servers map[string]*ServerConfig `json:"Servers"`
 	// Path to the config file
 	Path string `json:"-"`
 	// CurrentServer is the name of the server the user is currently using
 	CurrentServer string `json:"CurrentServer"`
+	// SecretBackend is the secret store holding the server secrets, the
+	// config file only keeps references to them. Secrets are stored in the
+	// config file when empty.
+	SecretBackend string `json:"secretBackend,omitempty"`
+
+	secrets   *secretState
+	overrides Overrides
+	env       bool
+	// legacyCredentials holds the kube credentials moved out of the servers
+	// by moveKubeCredentials, by server URL then key, until they're imported
+	// to the credential store.
+	legacyCredentials map[string]map[string]*ExecCredential
 }
 
 // ServerConfig holds the config for each server the user has setup
 type ServerConfig struct {
-	AccessKey          string                     `json:"accessKey"`
-	SecretKey          string                     `json:"secretKey"`
-	TokenKey           string                     `json:"tokenKey"`
-	URL                string                     `json:"url"`
-	Project            string                     `json:"project"`
-	CACerts            string                     `json:"cacert"`
-	KubeCredentials    map[string]*ExecCredential `json:"kubeCredentials"`
-	KubeConfigs        map[string]*api.Config     `json:"kubeConfigs"`
-	ProxyURL           string                     `json:"proxyUrl"`
-	HTTPTimeoutSeconds int                        `json:"httpTimeoutSeconds"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+	TokenKey  string `json:"tokenKey"`
+	URL       string `json:"url"`
+	Project   string `json:"project"`
+	CACerts   string `json:"cacert"`
+	// KubeCredentials is only read to migrate older configs, kube credentials
+	// are cached in the CredentialStore.
+	KubeCredentials map[string]*ExecCredential `json:"kubeCredentials,omitempty"`
+	KubeConfigs     map[string]*api.Config     `json:"kubeConfigs"`
+	// KubeConfigTokens records the tokens of KubeConfigs, by the same keys,
+	// so that they're only validated against the server near their expiry.
+	KubeConfigTokens   map[string]*KubeConfigToken `json:"kubeConfigTokens,omitempty"`
+	ProxyURL           string                      `json:"proxyUrl"`
+	HTTPTimeoutSeconds int                         `json:"httpTimeoutSeconds"`
+	// OAuthTokens holds the refresh tokens of the OAuth providers, by user ID.
+	// They're only kept when the secrets are stored in a secret store.
+	OAuthTokens map[string]*OAuthToken `json:"oauthTokens,omitempty"`
+
+	context *contextOverride
+}
+
+// OAuthToken is the refresh token issued by an OAuth provider when logging in
+// through it, used to renew the kubeconfig tokens without user interaction.
+type OAuthToken struct {
+	AuthProvider string `json:"authProvider"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// KubeConfigToken records the token of a cached kubeconfig.
+type KubeConfigToken struct {
+	// AccessKey is the API token the kubeconfig was generated with.
+	AccessKey string `json:"accessKey"`
+	ClusterID string `json:"clusterId"`
+	// ExpiresAt is unset when the token doesn't expire.
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	ValidatedAt time.Time  `json:"validatedAt"`
+	// Endpoint is the context of the kubeconfig selected by `--endpoint
+	// auto`, reused until the token is validated again.
+	Endpoint string `json:"endpoint,omitempty"`
 }
 
 func (c *ServerConfig) GetHTTPTimeout() time.Duration {
@@ -57,7 +101,10 @@ func LoadFromPath(path string) (Config, error) {
 	if err != nil {
 		// it's okay if the file is empty, we still return a valid config
 		if os.IsNotExist(err) {
-			return cf, nil
+			if err := cf.migrate(); err != nil {
+				return cf, err
+			}
+			return cf, cf.applyEnv()
 		}
 
 		return cf, err
@@ -68,6 +115,21 @@ func LoadFromPath(path string) (Config, error) {
 	}
 	cf.Path = path
 
+	if cf.SecretBackend != "" {
+		if err := cf.resolveSecrets(); err != nil {
+			return cf, fmt.Errorf("loading secrets: %w", err)
+		}
+	}
+
+	// the migrated config is saved by the next write
+	if err := cf.migrate(); err != nil {
+		return cf, err
+	}
+
+	if err := cf.applyEnv(); err != nil {
+		return cf, err
+	}
+
 	return cf, nil
 }
 
@@ -102,32 +164,149 @@ func GetFilePermissionWarnings(path string) ([]string, error) {
 	return warnings, nil
 }
 
+// Write saves the config to its path. The file is replaced atomically and
+// the write is serialized with other rancher processes, but changes made by
+// them since the config was loaded are overwritten: use Update for
+// read-modify-write cycles.
 func (c Config) Write() error {
+	if c.env {
+		return ErrEnvironmentConfig
+	}
+
+	unlock, err := lock(c.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.write()
+}
+
+// Update loads the config at path, applies fn and saves the result while
+// holding the config lock, so that concurrent updates from other rancher
+// processes are not lost. Nothing is written if fn returns an error, or if
+// the config is built from the environment.
+func Update(path string, fn func(*Config) error) error {
+	if envEnabled() {
+		cf, err := LoadFromPath(path)
+		if err != nil {
+			return err
+		}
+		logrus.Debugf("Not saving %s, the config is built from the environment", path)
+		return fn(&cf)
+	}
+
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cf, err := LoadFromPath(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(&cf); err != nil {
+		return err
+	}
+	return cf.write()
+}
+
+func (c Config) write() error {
 	err := os.MkdirAll(filepath.Dir(c.Path), 0700)
 	if err != nil {
 		return err
 	}
+
+	// the kube credentials moved out of the config are saved to the
+	// credential store before the config stops holding them
+	if len(c.legacyCredentials) > 0 {
+		if err := c.UpdateCredentials(func(*CredentialStore) error { return nil }); err != nil {
+			return fmt.Errorf("importing the kube credentials: %w", err)
+		}
+	}
 	logrus.Infof("Saving config to %s", c.Path)
-	p := c.Path
-	c.Path = ""
-	output, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+
+	content, cleanup, err := c.externalizeSecrets()
+	if err != nil {
+		return err
+	}
+
+	content.Path = ""
+	content.Version = CurrentVersion
+	data, err := json.Marshal(content)
 	if err != nil {
 		return err
 	}
-	defer output.Close()
+	if err := writeFileAtomic(c.Path, append(data, '\n')); err != nil {
+		return err
+	}
 
-	return json.NewEncoder(output).Encode(c)
+	if err := cleanup(); err != nil {
+		logrus.Warnf("Unable to remove stale secrets: %s", err)
+	}
+	return nil
 }
 
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so that readers never see a partially written file. An existing
+// file keeps its permissions, new files are only readable by the user.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	// Only removes the temporary file if the rename didn't happen.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// GetCurrentServer returns the server in use, with the overrides applied.
 func (c Config) GetCurrentServer() (*ServerConfig, error) {
-	server, found := c.Servers[c.CurrentServer]
+	if c.overrides.Server != "" {
+		if _, server := c.LookupServer(c.overrides.Server); server == nil {
+			return nil, fmt.Errorf("server %s is not configured", c.overrides.Server)
+		}
+	}
+
+	server, found := c.Servers[c.CurrentServerName()]
 	if !found || server == nil {
 		return nil, ErrNoConfigurationFound
 	}
+
+	if c.overrides.Context != "" || c.overrides.Cluster != "" {
+		if err := server.OverrideContext(c.overrides.Context, c.overrides.Cluster); err != nil {
+			return nil, err
+		}
+	}
 	return server, nil
 }
 
 func (c ServerConfig) GetCurrentCluster() string {
+	if c.context != nil {
+		return c.context.cluster
+	}
 	cluster, _, ok := strings.Cut(c.Project, ":")
 	if !ok {
 		return ""
@@ -136,13 +315,12 @@ func (c ServerConfig) GetCurrentCluster() string {
 }
 
 func (c ServerConfig) GetCurrentProject() string {
+	if c.context != nil {
+		return c.context.project
+	}
 	return c.Project
 }
 
-func (c ServerConfig) KubeToken(key string) *ExecCredential {
-	return c.KubeCredentials[key]
-}
-
 func (c ServerConfig) EnvironmentURL() (string, error) {
 	url, err := baseURL(c.URL)
 	if err != nil {
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -129,6 +131,7 @@ func TestLoadFromPath(t *testing.T) {
 			name:    "valid config",
 			content: validConfigContent,
 			expectedConf: Config{
+				Version: CurrentVersion,
 				Servers: map[string]*ServerConfig{
 					"rancherDefault": {
 						AccessKey: "the-access-key",
@@ -154,6 +157,7 @@ func TestLoadFromPath(t *testing.T) {
 			name:    "non existing file",
 			content: "",
 			expectedConf: Config{
+				Version:       CurrentVersion,
 				Servers:       map[string]*ServerConfig{},
 				CurrentServer: "",
 			},
@@ -188,3 +192,169 @@ func TestLoadFromPath(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cli2.json")
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Update(path, func(cf *Config) error {
+				cf.Servers[fmt.Sprintf("server-%d", i)] = &ServerConfig{URL: "https://rancher.example.com"}
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	conf, err := LoadFromPath(path)
+	assert.NoError(t, err)
+	assert.Len(t, conf.Servers, 20)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode())
+
+	// nothing is written when fn fails
+	err = Update(path, func(cf *Config) error {
+		cf.Servers = nil
+		return fmt.Errorf("failed")
+	})
+	assert.Error(t, err)
+
+	conf, err = LoadFromPath(path)
+	assert.NoError(t, err)
+	assert.Len(t, conf.Servers, 20)
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.Contains(t, []string{"cli2.json", "cli2.json.lock"}, entry.Name())
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	t.Parallel()
+
+	newConfig := func() Config {
+		return Config{
+			CurrentServer: "server1",
+			Servers: map[string]*ServerConfig{
+				"server1": {URL: "https://myserver-1.com", Project: "c-11111:p-11111"},
+				"server2": {URL: "https://myserver-2.com:8443", Project: "c-22222:p-22222"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		overrides       Overrides
+		expectedServer  string
+		expectedCluster string
+		expectedProject string
+		expectedErr     string
+	}{
+		{
+			name:            "no overrides",
+			expectedServer:  "server1",
+			expectedCluster: "c-11111",
+			expectedProject: "c-11111:p-11111",
+		},
+		{
+			name:            "server by name",
+			overrides:       Overrides{Server: "server2"},
+			expectedServer:  "server2",
+			expectedCluster: "c-22222",
+			expectedProject: "c-22222:p-22222",
+		},
+		{
+			name:            "server by host",
+			overrides:       Overrides{Server: "myserver-2.com:8443"},
+			expectedServer:  "server2",
+			expectedCluster: "c-22222",
+			expectedProject: "c-22222:p-22222",
+		},
+		{
+			name:            "context",
+			overrides:       Overrides{Context: "c-33333:p-33333"},
+			expectedServer:  "server1",
+			expectedCluster: "c-33333",
+			expectedProject: "c-33333:p-33333",
+		},
+		{
+			name:            "cluster of the current context keeps the project",
+			overrides:       Overrides{Cluster: "c-11111"},
+			expectedServer:  "server1",
+			expectedCluster: "c-11111",
+			expectedProject: "c-11111:p-11111",
+		},
+		{
+			name:            "another cluster clears the project",
+			overrides:       Overrides{Cluster: "c-33333"},
+			expectedServer:  "server1",
+			expectedCluster: "c-33333",
+			expectedProject: "",
+		},
+		{
+			name:        "context of another cluster",
+			overrides:   Overrides{Context: "c-33333:p-33333", Cluster: "c-11111"},
+			expectedErr: "context c-33333:p-33333 doesn't belong to cluster c-11111",
+		},
+		{
+			name:        "invalid context",
+			overrides:   Overrides{Context: "p-33333"},
+			expectedErr: `invalid context "p-33333", must be in the <cluster-id>:<project-id> format`,
+		},
+		{
+			name:        "unknown server",
+			overrides:   Overrides{Server: "notfound-server"},
+			expectedErr: "server notfound-server is not configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			conf := newConfig()
+			conf.SetOverrides(tt.overrides)
+
+			server, err := conf.GetCurrentServer()
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedServer, conf.CurrentServerName())
+			assert.Same(t, conf.Servers[tt.expectedServer], server)
+			assert.Equal(t, tt.expectedCluster, server.GetCurrentCluster())
+			assert.Equal(t, tt.expectedProject, server.GetCurrentProject())
+		})
+	}
+}
+
+func TestOverridesAreNotWritten(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cli2.json")
+	assert.NoError(t, os.WriteFile(path, []byte(validConfigContent), 0600))
+
+	conf, err := LoadFromPath(path)
+	assert.NoError(t, err)
+	conf.SetOverrides(Overrides{Context: "c-33333:p-33333"})
+	_, err = conf.GetCurrentServer()
+	assert.NoError(t, err)
+	assert.NoError(t, conf.Write())
+
+	conf, err = LoadFromPath(path)
+	assert.NoError(t, err)
+	server, err := conf.GetCurrentServer()
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster-id:project-id", server.GetCurrentProject())
+}
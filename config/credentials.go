@@ -0,0 +1,262 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// credentialsFile is the name of the credential store, next to the config file.
+const credentialsFile = "kube-credentials.json"
+
+// CredentialStore caches the kube credentials issued to `rancher token`. It's
+// kept in its own file, next to the config, so that credentials don't depend
+// on a server being configured: `rancher token` is run by kubectl with the
+// URL of the server, possibly before `rancher login`, and the credentials
+// outlive `rancher server delete`.
+type CredentialStore struct {
+	// Servers holds the credentials by normalized server URL, see
+	// NormalizeServerURL, then by <user-id>_<cluster-id>.
+	Servers map[string]map[string]*ExecCredential `json:"servers"`
+	// ImportedConfig is set once the kube credentials of the config have
+	// been imported to the store, see importLegacyCredentials.
+	ImportedConfig bool `json:"importedConfig,omitempty"`
+
+	path          string
+	secretBackend string
+	secrets       *secretState
+}
+
+// CredentialStorePath returns the path of the credential store of the config.
+func (c Config) CredentialStorePath() string {
+	return filepath.Join(filepath.Dir(c.Path), credentialsFile)
+}
+
+// LoadCredentials loads the credential store of the config. Its secrets are
+// kept in the secret store of the config, if any. The kube credentials of an
+// older config are included, they're saved to the store by the next update of
+// the store or of the config.
+func (c Config) LoadCredentials() (*CredentialStore, error) {
+	s, err := loadCredentialStore(c.CredentialStorePath(), c.SecretBackend)
+	if err != nil {
+		return nil, err
+	}
+	c.importLegacyCredentials(s)
+	return s, nil
+}
+
+// UpdateCredentials loads the credential store of the config, applies fn and
+// saves the result while holding the lock of the store. Nothing is written if
+// fn returns an error, or if the config is built from the environment.
+func (c Config) UpdateCredentials(fn func(*CredentialStore) error) error {
+	path := c.CredentialStorePath()
+	if c.env {
+		s, err := loadCredentialStore(path, c.SecretBackend)
+		if err != nil {
+			return err
+		}
+		logrus.Debugf("Not saving %s, the config is built from the environment", path)
+		return fn(s)
+	}
+
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := loadCredentialStore(path, c.SecretBackend)
+	if err != nil {
+		return err
+	}
+	c.importLegacyCredentials(s)
+	if err := fn(s); err != nil {
+		return err
+	}
+	return s.write()
+}
+
+// importLegacyCredentials adds the kube credentials moved out of an older
+// config by moveKubeCredentials to s. Credentials already in the store take
+// precedence, and they're only imported once so that credentials deleted from
+// the store aren't imported again from a config that wasn't saved since.
+func (c Config) importLegacyCredentials(s *CredentialStore) {
+	if len(c.legacyCredentials) == 0 || s.ImportedConfig {
+		return
+	}
+	for server, creds := range c.legacyCredentials {
+		for key, cred := range creds {
+			if s.Get(server, key) == nil {
+				s.Set(server, key, cred)
+			}
+		}
+	}
+	s.ImportedConfig = true
+}
+
+func loadCredentialStore(path, secretBackend string) (*CredentialStore, error) {
+	s := &CredentialStore{
+		Servers:       make(map[string]map[string]*ExecCredential),
+		path:          path,
+		secretBackend: secretBackend,
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("unmarshaling %s: %w", path, err)
+	}
+	if s.Servers == nil {
+		s.Servers = make(map[string]map[string]*ExecCredential)
+	}
+
+	if secretBackend != "" {
+		state, err := loadSecrets(secretBackend, filepath.Dir(path), s.walkSecrets)
+		if err != nil {
+			return nil, fmt.Errorf("loading secrets: %w", err)
+		}
+		s.secrets = state
+	}
+	return s, nil
+}
+
+func (s *CredentialStore) write() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	logrus.Debugf("Saving credentials to %s", s.path)
+
+	out := s.deepCopy()
+	cleanup, err := storeSecrets(s.secrets, s.secretBackend, filepath.Dir(s.path), out.walkSecrets)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, append(data, '\n')); err != nil {
+		return err
+	}
+
+	if err := cleanup(); err != nil {
+		logrus.Warnf("Unable to remove stale secrets: %s", err)
+	}
+	return nil
+}
+
+// SetSecretBackend changes the secret store the secrets of the credential
+// store are saved to, when migrating the secrets of the config.
+func (s *CredentialStore) SetSecretBackend(backend string) {
+	s.secretBackend = backend
+}
+
+// Get returns the credential cached for the server under key, nil if there's
+// none.
+func (s *CredentialStore) Get(server, key string) *ExecCredential {
+	return s.Servers[normalizeServerKey(server)][key]
+}
+
+// Set caches the credential for the server under key.
+func (s *CredentialStore) Set(server, key string, cred *ExecCredential) {
+	server = normalizeServerKey(server)
+	if s.Servers[server] == nil {
+		s.Servers[server] = make(map[string]*ExecCredential)
+	}
+	s.Servers[server][key] = cred
+}
+
+// Delete removes the credential cached for the server under key.
+func (s *CredentialStore) Delete(server, key string) {
+	server = normalizeServerKey(server)
+	delete(s.Servers[server], key)
+	if len(s.Servers[server]) == 0 {
+		delete(s.Servers, server)
+	}
+}
+
+// ServerCredentials returns the credentials cached for the server, by key.
+func (s *CredentialStore) ServerCredentials(server string) map[string]*ExecCredential {
+	return s.Servers[normalizeServerKey(server)]
+}
+
+// walkSecrets calls fn with the store key and a pointer to each sensitive
+// value of the credential store. Keys are prefixed so that they don't collide
+// with the secrets of the config.
+func (s *CredentialStore) walkSecrets(fn func(key string, value *string) error) error {
+	for server, creds := range s.Servers {
+		for key, cred := range creds {
+			if cred == nil || cred.Status == nil {
+				continue
+			}
+			prefix := "credentials/" + server + "/" + key
+			if err := fn(prefix+"/token", &cred.Status.Token); err != nil {
+				return err
+			}
+			if err := fn(prefix+"/clientKeyData", &cred.Status.ClientKeyData); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *CredentialStore) deepCopy() *CredentialStore {
+	out := *s
+	out.Servers = make(map[string]map[string]*ExecCredential, len(s.Servers))
+	for server, creds := range s.Servers {
+		out.Servers[server] = make(map[string]*ExecCredential, len(creds))
+		for key, cred := range creds {
+			out.Servers[server][key] = cred.deepCopy()
+		}
+	}
+	return &out
+}
+
+// NormalizeServerURL returns the scheme and host of the server URL, the form
+// credentials are cached under. The scheme defaults to https, the host is
+// lowercased and default ports are dropped, so that the URLs found in the
+// kubeconfig files and those passed to --server match.
+func NormalizeServerURL(server string) (string, error) {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q", server)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host, nil
+}
+
+// normalizeServerKey returns the normalized URL of server, or server itself
+// when it can't be parsed.
+func normalizeServerKey(server string) string {
+	if normalized, err := NormalizeServerURL(server); err == nil {
+		return normalized
+	}
+	return server
+}
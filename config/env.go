@@ -0,0 +1,110 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// URLEnv is the URL of the Rancher server, it enables the environment config.
+	URLEnv = "RANCHER_URL"
+	// TokenEnv is the API token used to authenticate, it enables the environment config.
+	TokenEnv = "RANCHER_TOKEN"
+	// CACertsEnv is the CA certificate of the server, as PEM content or the path to a PEM file.
+	CACertsEnv = "RANCHER_CA_CERTS"
+	// ContextEnv is the project used by the commands, in the <cluster-id>:<project-id> format.
+	ContextEnv = "RANCHER_CONTEXT"
+	// ProxyURLEnv is the URL of the proxy used to reach the server.
+	ProxyURLEnv = "RANCHER_PROXY_URL"
+)
+
+// ErrEnvironmentConfig is returned when saving a config built from the environment.
+var ErrEnvironmentConfig = fmt.Errorf("the config is built from %s and %s and can't be saved, unset them first", URLEnv, TokenEnv)
+
+// envEnabled reports whether the environment config is enabled.
+func envEnabled() bool {
+	return os.Getenv(URLEnv) != "" || os.Getenv(TokenEnv) != ""
+}
+
+// FromEnvironment reports whether the current server of the config is built
+// from the environment. Such a config is never written to disk.
+func (c Config) FromEnvironment() bool {
+	return c.env
+}
+
+// applyEnv layers the server configured by the environment over the config
+// loaded from the file, the environment taking precedence. It's enabled by
+// RANCHER_URL or RANCHER_TOKEN: the server matching RANCHER_URL, or the
+// current server when only the token is set, is replaced in memory by a copy
+// holding the values of the environment, and becomes the current server.
+func (c *Config) applyEnv() error {
+	if !envEnabled() {
+		return nil
+	}
+	serverURL, token := os.Getenv(URLEnv), os.Getenv(TokenEnv)
+
+	var (
+		name   string
+		server ServerConfig
+	)
+	if serverURL != "" {
+		u, err := url.ParseRequestURI(serverURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid %s %q, must be an http(s) URL (e.g. https://rancher.yourdomain.com)", URLEnv, serverURL)
+		}
+		u.Path = ""
+
+		var sc *ServerConfig
+		name, sc = c.LookupServer(u.Host)
+		if sc != nil {
+			server = *sc
+		}
+		server.URL = u.String()
+	} else {
+		sc, err := c.GetCurrentServer()
+		if err != nil {
+			return fmt.Errorf("%s is required when no server is configured", URLEnv)
+		}
+		name, server = c.CurrentServer, *sc
+	}
+
+	if token != "" {
+		accessKey, secretKey, ok := strings.Cut(token, ":")
+		if !ok || accessKey == "" || secretKey == "" {
+			return fmt.Errorf("invalid %s, must be in the <access-key>:<secret-key> format", TokenEnv)
+		}
+		server.AccessKey, server.SecretKey, server.TokenKey = accessKey, secretKey, token
+	}
+
+	if caCerts := os.Getenv(CACertsEnv); caCerts != "" {
+		if !strings.HasPrefix(strings.TrimSpace(caCerts), "-----BEGIN") {
+			content, err := os.ReadFile(caCerts)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", CACertsEnv, err)
+			}
+			caCerts = string(content)
+		}
+		server.CACerts = caCerts
+	}
+	if proxyURL := os.Getenv(ProxyURLEnv); proxyURL != "" {
+		server.ProxyURL = proxyURL
+	}
+	if project := os.Getenv(ContextEnv); project != "" {
+		server.Project = project
+	}
+
+	if server.AccessKey == "" {
+		return errors.New(TokenEnv + " is required")
+	}
+
+	logrus.Debugf("Using server %s configured by the environment", server.URL)
+	c.Servers[name] = &server
+	c.CurrentServer = name
+	c.env = true
+	return nil
+}
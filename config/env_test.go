@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironmentOnlyConfig(t *testing.T) {
+	t.Setenv(URLEnv, "https://rancher.example.com/v3")
+	t.Setenv(TokenEnv, "token-abcde:the-secret")
+	t.Setenv(ContextEnv, "c-12345:p-12345")
+	t.Setenv(ProxyURLEnv, "http://proxy.example.com:3128")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli2.json")
+
+	conf, err := LoadFromPath(path)
+	require.NoError(t, err)
+	assert.True(t, conf.FromEnvironment())
+
+	server, err := conf.GetCurrentServer()
+	require.NoError(t, err)
+	assert.Equal(t, "rancher.example.com", conf.CurrentServer)
+	assert.Equal(t, "https://rancher.example.com", server.URL)
+	assert.Equal(t, "token-abcde", server.AccessKey)
+	assert.Equal(t, "the-secret", server.SecretKey)
+	assert.Equal(t, "token-abcde:the-secret", server.TokenKey)
+	assert.Equal(t, "c-12345:p-12345", server.Project)
+	assert.Equal(t, "http://proxy.example.com:3128", server.ProxyURL)
+
+	assert.ErrorIs(t, conf.Write(), ErrEnvironmentConfig)
+
+	err = Update(path, func(cf *Config) error {
+		sc, err := cf.GetCurrentServer()
+		require.NoError(t, err)
+		sc.KubeCredentials = map[string]*ExecCredential{
+			"u-abcde_c-12345": {Status: &ExecCredentialStatus{Token: "kubeconfig-u-abcde:token"}},
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// nothing is written, not even the lock file
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestEnvironmentOverridesConfigFile(t *testing.T) {
+	content := `{
+  "Servers": {
+    "rancherDefault": {
+      "accessKey": "the-access-key",
+      "secretKey": "the-secret-key",
+      "tokenKey": "the-access-key:the-secret-key",
+      "url": "https://example.com",
+      "project": "cluster-id:project-id",
+      "proxyUrl": "http://proxy.example.com:3128",
+      "httpTimeoutSeconds": 30
+    },
+    "other": {
+      "url": "https://other.example.com"
+    }
+  },
+  "CurrentServer": "other"
+}`
+
+	tests := []struct {
+		name              string
+		env               map[string]string
+		expectedServer    string
+		expectedAccessKey string
+		expectedProxyURL  string
+		expectedErr       string
+	}{
+		{
+			name: "url of a configured server",
+			env: map[string]string{
+				URLEnv:   "https://example.com",
+				TokenEnv: "token-abcde:the-secret",
+			},
+			expectedServer:    "rancherDefault",
+			expectedAccessKey: "token-abcde",
+			expectedProxyURL:  "http://proxy.example.com:3128",
+		},
+		{
+			name: "environment takes precedence",
+			env: map[string]string{
+				URLEnv:      "https://example.com",
+				ProxyURLEnv: "http://other-proxy.example.com:3128",
+			},
+			expectedServer:    "rancherDefault",
+			expectedAccessKey: "the-access-key",
+			expectedProxyURL:  "http://other-proxy.example.com:3128",
+		},
+		{
+			name: "token without a token for the server",
+			env: map[string]string{
+				URLEnv: "https://other.example.com",
+			},
+			expectedErr: TokenEnv + " is required",
+		},
+		{
+			name: "invalid url",
+			env: map[string]string{
+				URLEnv:   "ftp://example.com",
+				TokenEnv: "token-abcde:the-secret",
+			},
+			expectedErr: `invalid RANCHER_URL "ftp://example.com", must be an http(s) URL (e.g. https://rancher.yourdomain.com)`,
+		},
+		{
+			name: "invalid token",
+			env: map[string]string{
+				TokenEnv: "token-abcde",
+			},
+			expectedErr: "invalid RANCHER_TOKEN, must be in the <access-key>:<secret-key> format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			path := filepath.Join(t.TempDir(), "cli2.json")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+			conf, err := LoadFromPath(path)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			server, err := conf.GetCurrentServer()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedServer, conf.CurrentServer)
+			assert.Equal(t, tt.expectedAccessKey, server.AccessKey)
+			assert.Equal(t, tt.expectedProxyURL, server.ProxyURL)
+			assert.Equal(t, 30, server.HTTPTimeoutSeconds)
+		})
+	}
+}
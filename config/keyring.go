@@ -0,0 +1,54 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"path/filepath"
+)
+
+// keyringService prefixes the service name the secrets are stored under in
+// the OS keyring.
+const keyringService = "rancher-cli"
+
+// keyringServiceFor returns the keyring service of the config directory dir,
+// so that the secrets of different config directories don't collide.
+func keyringServiceFor(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(dir)))
+	return keyringService + ":" + hex.EncodeToString(sum[:8])
+}
+
+// keyringSecretStore stores the secrets in the keyring of the operating
+// system: the Keychain on macOS, the Secret Service on Linux and the
+// Credential Manager on Windows. Values are base64 encoded so that multi-line
+// secrets like private keys survive the line oriented tooling.
+type keyringSecretStore struct {
+	service string
+}
+
+func newKeyringSecretStore(service string) *keyringSecretStore {
+	return &keyringSecretStore{service: service}
+}
+
+func (k *keyringSecretStore) Get(key string) (string, error) {
+	encoded, err := keyringGet(k.service, key)
+	if err != nil {
+		return "", err
+	}
+	value, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func (k *keyringSecretStore) Set(key, value string) error {
+	return keyringSet(k.service, key, base64.StdEncoding.EncodeToString([]byte(value)))
+}
+
+func (k *keyringSecretStore) Delete(key string) error {
+	return keyringDelete(k.service, key)
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errSecItemNotFound is the exit status of the security tool when the item doesn't exist.
+const errSecItemNotFound = 44
+
+func keyringGet(service, key string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", key, "-w").Output()
+	if err != nil {
+		return "", keychainError(err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func keyringSet(service, key, value string) error {
+	// The interactive mode reads the command from stdin, which keeps the
+	// secret out of the process arguments.
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", service, key, value))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("security: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	if stderr.Len() > 0 {
+		return fmt.Errorf("security: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func keyringDelete(service, key string) error {
+	if err := exec.Command("security", "delete-generic-password", "-s", service, "-a", key).Run(); err != nil {
+		return keychainError(err)
+	}
+	return nil
+}
+
+func keychainError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+		return ErrSecretNotFound
+	}
+	return fmt.Errorf("security: %w", err)
+}
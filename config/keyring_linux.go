@@ -0,0 +1,58 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service is driven through secret-tool (libsecret), which reads
+// the secret from stdin so it never shows up in the process arguments.
+
+func keyringGet(service, key string) (string, error) {
+	out, err := secretTool(nil, "lookup", "service", service, "key", key)
+	if err != nil {
+		return "", err
+	}
+	if len(out) == 0 {
+		return "", ErrSecretNotFound
+	}
+	return string(out), nil
+}
+
+func keyringSet(service, key, value string) error {
+	_, err := secretTool(strings.NewReader(value), "store", "--label", service+" "+key, "service", service, "key", key)
+	return err
+}
+
+func keyringDelete(service, key string) error {
+	_, err := secretTool(nil, "clear", "service", service, "key", key)
+	return err
+}
+
+func secretTool(stdin *strings.Reader, args ...string) ([]byte, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, errors.New("secret-tool is required to use the keyring secret backend, " +
+			"install libsecret or use the file backend")
+	}
+
+	cmd := exec.Command(path, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// lookup exits with 1 and no output when the secret doesn't exist.
+		var exitErr *exec.ExitError
+		if args[0] == "lookup" && errors.As(err, &exitErr) && stderr.Len() == 0 {
+			return nil, ErrSecretNotFound
+		}
+		return nil, fmt.Errorf("secret-tool %s: %s: %w", args[0], strings.TrimSpace(stderr.String()), err)
+	}
+	return out, nil
+}
@@ -0,0 +1,20 @@
+//go:build !darwin && !linux && !windows
+
+package config
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func keyringGet(service, key string) (string, error) {
+	return "", fmt.Errorf("the keyring secret backend is not supported on %s, use the file backend", runtime.GOOS)
+}
+
+func keyringSet(service, key, value string) error {
+	return fmt.Errorf("the keyring secret backend is not supported on %s, use the file backend", runtime.GOOS)
+}
+
+func keyringDelete(service, key string) error {
+	return fmt.Errorf("the keyring secret backend is not supported on %s, use the file backend", runtime.GOOS)
+}
@@ -1,6 +1,9 @@
 package config
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ExecCredential is used by exec-based plugins to communicate credentials to
 // HTTP transports. //v1beta1/types.go
@@ -19,7 +22,40 @@ type ExecCredential struct {
 
 // ExecCredentialSpec holds request and runtime specific information provided by
 // the transport.
-type ExecCredentialSpec struct{}
+type ExecCredentialSpec struct {
+	// Cluster contains information to allow an exec plugin to communicate with the
+	// kubernetes cluster being authenticated to. It's only set when
+	// provideClusterInfo is true in the exec config of the kubeconfig.
+	// +optional
+	Cluster *Cluster `json:"cluster,omitempty"`
+	// Interactive declares whether stdin has been passed to this exec plugin.
+	// +optional
+	Interactive bool `json:"interactive,omitempty"`
+}
+
+// Cluster contains information to allow an exec plugin to communicate with the
+// kubernetes cluster being authenticated to. //v1/types.go
+type Cluster struct {
+	// Server is the address of the kubernetes cluster (https://hostname:port).
+	Server string `json:"server"`
+	// TLSServerName is passed to the server for SNI and is used in the client to
+	// check server certificates against.
+	// +optional
+	TLSServerName string `json:"tls-server-name,omitempty"`
+	// InsecureSkipTLSVerify skips the validity check for the server's certificate.
+	// +optional
+	InsecureSkipTLSVerify bool `json:"insecure-skip-tls-verify,omitempty"`
+	// CAData contains PEM-encoded certificate authority certificates.
+	// +optional
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+	// ProxyURL is the URL to the proxy to be used for all requests to this cluster.
+	// +optional
+	ProxyURL string `json:"proxy-url,omitempty"`
+	// Config holds additional config data that is specific to the exec plugin,
+	// read from the client.authentication.k8s.io/exec extension of the cluster.
+	// +optional
+	Config json.RawMessage `json:"config,omitempty"`
+}
 
 // ExecCredentialStatus holds credentials for the transport to use.
 // Token and ClientKeyData are sensitive fields. This data should only be
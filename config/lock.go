@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockPath returns the path of the lock file guarding the config file at path.
+func lockPath(path string) string {
+	return path + ".lock"
+}
+
+// lock takes an exclusive lock guarding the config file at path, blocking
+// until it's available. The lock is held on a separate file since the config
+// file itself is replaced on each write.
+func lock(path string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(lockPath(path), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking %s: %w", path, err)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// legacyConfigFile is the config file of the Rancher 1.x CLI, still
+	// created by contrib/rancher.
+	legacyConfigFile = "cli.json"
+	// legacyServerName is the server the legacy config is imported as.
+	legacyServerName = "rancherDefault"
+)
+
+// migration upgrades a config from the previous version of the schema.
+type migration struct {
+	description string
+	migrate     func(c *Config) error
+}
+
+// migrations holds the chain of schema upgrades, migrations[i] upgrades a
+// config from version i to version i+1. Changes to the layout of the config,
+// such as moving secrets or caches to their own files, must be appended here
+// and never modify a released migration.
+var migrations = []migration{
+	{
+		description: "import the legacy cli.json",
+		migrate:     importLegacyConfig,
+	},
+	{
+		description: "merge the kube credentials cached under the server hostname",
+		migrate:     mergeHostCredentials,
+	},
+	{
+		description: "move the kube credentials to the credential store",
+		migrate:     moveKubeCredentials,
+	},
+}
+
+// CurrentVersion is the version of the config schema written by this CLI.
+var CurrentVersion = len(migrations)
+
+// migrate runs the migrations needed to bring the config to CurrentVersion.
+func (c *Config) migrate() error {
+	if c.Version > CurrentVersion {
+		return fmt.Errorf("config version %d is newer than the supported version %d, upgrade the rancher CLI", c.Version, CurrentVersion)
+	}
+	if c.Servers == nil {
+		c.Servers = make(map[string]*ServerConfig)
+	}
+
+	for ; c.Version < CurrentVersion; c.Version++ {
+		m := migrations[c.Version]
+		logrus.Debugf("Migrating config to version %d: %s", c.Version+1, m.description)
+		if err := m.migrate(c); err != nil {
+			return fmt.Errorf("migrating config to version %d (%s): %w", c.Version+1, m.description, err)
+		}
+	}
+	return nil
+}
+
+// legacyConfig is the format of the Rancher 1.x cli.json.
+type legacyConfig struct {
+	AccessKey   string `json:"accessKey"`
+	SecretKey   string `json:"secretKey"`
+	URL         string `json:"url"`
+	Environment string `json:"environment"`
+}
+
+// importLegacyConfig imports the server of the cli.json next to the config,
+// unless servers are already configured.
+func importLegacyConfig(c *Config) error {
+	if len(c.Servers) > 0 || c.Path == "" {
+		return nil
+	}
+
+	path := filepath.Join(filepath.Dir(c.Path), legacyConfigFile)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var legacy legacyConfig
+	if err := json.Unmarshal(content, &legacy); err != nil {
+		return fmt.Errorf("unmarshaling %s: %w", path, err)
+	}
+	// contrib/rancher creates an empty cli.json
+	if legacy.URL == "" || legacy.AccessKey == "" {
+		return nil
+	}
+
+	u, err := url.Parse(legacy.URL)
+	if err != nil {
+		return fmt.Errorf("parsing the url of %s: %w", path, err)
+	}
+	u.Path = ""
+
+	c.Servers[legacyServerName] = &ServerConfig{
+		AccessKey: legacy.AccessKey,
+		SecretKey: legacy.SecretKey,
+		TokenKey:  legacy.AccessKey + ":" + legacy.SecretKey,
+		URL:       u.String(),
+	}
+	c.CurrentServer = legacyServerName
+
+	logrus.Infof("Imported server %s from %s", u.String(), path)
+	if legacy.Environment != "" {
+		logrus.Warnf("The environment %s of %s can't be converted to a project, run `rancher context switch`", legacy.Environment, path)
+	}
+	return nil
+}
+
+// mergeHostCredentials moves the kube credentials that `rancher token`
+// cached under the hostname passed to --server to the server configured for
+// that hostname. Hostnames matching several servers are left untouched.
+func mergeHostCredentials(c *Config) error {
+	for name, server := range c.Servers {
+		if !isCredentialsOnly(server) {
+			continue
+		}
+		target, sc := c.LookupServer(name)
+		if sc == nil || target == name {
+			continue
+		}
+
+		if sc.KubeCredentials == nil {
+			sc.KubeCredentials = make(map[string]*ExecCredential)
+		}
+		for key, cred := range server.KubeCredentials {
+			// credentials cached for the configured server take precedence
+			if sc.KubeCredentials[key] == nil {
+				sc.KubeCredentials[key] = cred
+			}
+		}
+		delete(c.Servers, name)
+		logrus.Debugf("Moved the kube credentials of %s to server %s", name, target)
+	}
+	return nil
+}
+
+// moveKubeCredentials moves the kube credentials cached by `rancher token` in
+// the servers of the config out of them, and removes the servers only created
+// to hold them. Loading the config doesn't write anything: the credentials
+// are imported to the credential store when it's updated or when the config
+// is saved, see importLegacyCredentials.
+func moveKubeCredentials(c *Config) error {
+	if c.Path == "" || envEnabled() {
+		return nil
+	}
+
+	for name, server := range c.Servers {
+		if server == nil || len(server.KubeCredentials) == 0 {
+			continue
+		}
+		serverURL := server.URL
+		if serverURL == "" {
+			// the URL passed to `rancher token --server`
+			serverURL = name
+		}
+		if c.legacyCredentials == nil {
+			c.legacyCredentials = make(map[string]map[string]*ExecCredential)
+		}
+		if c.legacyCredentials[serverURL] == nil {
+			c.legacyCredentials[serverURL] = make(map[string]*ExecCredential)
+		}
+		for key, cred := range server.KubeCredentials {
+			if cred == nil || cred.Status == nil {
+				continue
+			}
+			c.legacyCredentials[serverURL][key] = cred
+		}
+
+		if isCredentialsOnly(server) {
+			delete(c.Servers, name)
+		} else {
+			server.KubeCredentials = nil
+		}
+		logrus.Debugf("Moving the kube credentials of %s to %s", name, c.CredentialStorePath())
+	}
+	return nil
+}
+
+// isCredentialsOnly reports whether the server was created by `rancher token`
+// to cache kube credentials, without logging in.
+func isCredentialsOnly(s *ServerConfig) bool {
+	if s == nil {
+		return false
+	}
+	return s.URL == "" && s.AccessKey == "" && s.SecretKey == "" && s.TokenKey == "" &&
+		s.Project == "" && s.CACerts == "" && s.ProxyURL == "" && s.HTTPTimeoutSeconds == 0 &&
+		len(s.KubeConfigs) == 0
+}
+
+// LookupServer returns the name and config of the server matching name. The
+// name is either the name of a server or the host of its URL, as found in the
+// kubeconfig files generated by Rancher. A host must match a single server.
+func (c Config) LookupServer(name string) (string, *ServerConfig) {
+	if sc := c.Servers[name]; sc != nil && !isCredentialsOnly(sc) {
+		return name, sc
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(name, "https://"), "http://"), "/")
+	var (
+		found string
+		match *ServerConfig
+	)
+	for serverName, sc := range c.Servers {
+		if sc == nil || sc.URL == "" {
+			continue
+		}
+		u, err := url.Parse(sc.URL)
+		if err != nil || u.Host != host {
+			continue
+		}
+		if match != nil {
+			// ambiguous
+			return name, c.Servers[name]
+		}
+		found, match = serverName, sc
+	}
+	if match == nil {
+		return name, c.Servers[name]
+	}
+	return found, match
+}
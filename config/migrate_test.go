@@ -0,0 +1,253 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateLegacyConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		legacyContent   string
+		configContent   string
+		expectedServers int
+	}{
+		{
+			name:            "legacy config is imported",
+			legacyContent:   `{"accessKey":"access","secretKey":"secret","url":"https://rancher.example.com/v2-beta","environment":"1a5"}`,
+			expectedServers: 1,
+		},
+		{
+			name:            "empty legacy config created by contrib/rancher",
+			legacyContent:   `{"accessKey":"","secretKey":"","url":"","environment":""}`,
+			expectedServers: 0,
+		},
+		{
+			name:            "legacy config is ignored when servers are configured",
+			legacyContent:   `{"accessKey":"access","secretKey":"secret","url":"https://legacy.example.com/v1","environment":""}`,
+			configContent:   validConfigContent,
+			expectedServers: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "cli2.json")
+			require.NoError(t, os.WriteFile(filepath.Join(dir, legacyConfigFile), []byte(tt.legacyContent), 0600))
+			if tt.configContent != "" {
+				require.NoError(t, os.WriteFile(path, []byte(tt.configContent), 0600))
+			}
+
+			conf, err := LoadFromPath(path)
+			require.NoError(t, err)
+			assert.Equal(t, CurrentVersion, conf.Version)
+			assert.Len(t, conf.Servers, tt.expectedServers)
+
+			server, err := conf.GetCurrentServer()
+			if tt.expectedServers == 0 {
+				assert.ErrorIs(t, err, ErrNoConfigurationFound)
+				return
+			}
+			require.NoError(t, err)
+			if tt.configContent == "" {
+				assert.Equal(t, "https://rancher.example.com", server.URL)
+				assert.Equal(t, "access:secret", server.TokenKey)
+			} else {
+				assert.Equal(t, "https://example.com", server.URL)
+			}
+		})
+	}
+}
+
+func TestMigrateHostCredentials(t *testing.T) {
+	t.Parallel()
+
+	content := `{
+  "Servers": {
+    "prod": {
+      "url": "https://rancher.example.com",
+      "tokenKey": "token-abcde:secret",
+      "kubeCredentials": {
+        "u-abcde_c-12345": {"status": {"token": "kubeconfig-u-abcde:configured"}}
+      }
+    },
+    "rancher.example.com": {
+      "kubeCredentials": {
+        "u-abcde_c-12345": {"status": {"token": "kubeconfig-u-abcde:phantom"}},
+        "u-abcde_c-67890": {"status": {"token": "kubeconfig-u-abcde:moved"}}
+      }
+    },
+    "unknown.example.com": {
+      "kubeCredentials": {
+        "u-abcde_c-12345": {"status": {"token": "kubeconfig-u-abcde:kept"}}
+      }
+    }
+  },
+  "CurrentServer": "prod"
+}`
+
+	path := filepath.Join(t.TempDir(), "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	conf, err := LoadFromPath(path)
+	require.NoError(t, err)
+
+	assert.NotContains(t, conf.Servers, "rancher.example.com")
+	assert.NotContains(t, conf.Servers, "unknown.example.com")
+	assert.Nil(t, conf.Servers["prod"].KubeCredentials)
+	// loading the config doesn't write the credential store
+	assert.NoFileExists(t, conf.CredentialStorePath())
+
+	creds, err := conf.LoadCredentials()
+	require.NoError(t, err)
+	assert.True(t, creds.ImportedConfig)
+	assert.Equal(t, "kubeconfig-u-abcde:configured", creds.Get("https://rancher.example.com", "u-abcde_c-12345").Status.Token)
+	assert.Equal(t, "kubeconfig-u-abcde:moved", creds.Get("https://rancher.example.com", "u-abcde_c-67890").Status.Token)
+	assert.Equal(t, "kubeconfig-u-abcde:kept", creds.Get("https://unknown.example.com", "u-abcde_c-12345").Status.Token)
+
+	name, server := conf.LookupServer("rancher.example.com")
+	assert.Equal(t, "prod", name)
+	assert.Same(t, conf.Servers["prod"], server)
+
+	// credentials deleted from the store aren't imported again from the
+	// config, which is only saved by the next write
+	require.NoError(t, conf.UpdateCredentials(func(s *CredentialStore) error {
+		s.Delete("rancher.example.com", "u-abcde_c-67890")
+		return nil
+	}))
+	conf, err = LoadFromPath(path)
+	require.NoError(t, err)
+	creds, err = conf.LoadCredentials()
+	require.NoError(t, err)
+	assert.Nil(t, creds.Get("https://rancher.example.com", "u-abcde_c-67890"))
+}
+
+func TestMigrateKubeCredentialsOnWrite(t *testing.T) {
+	t.Parallel()
+
+	content := `{
+  "Servers": {
+    "rancher.example.com": {
+      "kubeCredentials": {
+        "u-abcde_c-12345": {"status": {"token": "kubeconfig-u-abcde:moved"}}
+      }
+    }
+  }
+}`
+
+	path := filepath.Join(t.TempDir(), "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	conf, err := LoadFromPath(path)
+	require.NoError(t, err)
+	assert.NoFileExists(t, conf.CredentialStorePath())
+
+	// the credentials are saved to the store before the config drops them
+	require.NoError(t, conf.Write())
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(saved), "kubeconfig-u-abcde:moved")
+
+	conf, err = LoadFromPath(path)
+	require.NoError(t, err)
+	creds, err := conf.LoadCredentials()
+	require.NoError(t, err)
+	assert.True(t, creds.ImportedConfig)
+	assert.Equal(t, "kubeconfig-u-abcde:moved", creds.Get("https://rancher.example.com", "u-abcde_c-12345").Status.Token)
+}
+
+func TestNormalizeServerURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		server   string
+		expected string
+	}{
+		{server: "rancher.example.com", expected: "https://rancher.example.com"},
+		{server: "https://Rancher.Example.com/", expected: "https://rancher.example.com"},
+		{server: "https://rancher.example.com:443/v3", expected: "https://rancher.example.com"},
+		{server: "https://rancher.example.com:8443", expected: "https://rancher.example.com:8443"},
+		{server: "http://rancher.example.com:80", expected: "http://rancher.example.com"},
+		{server: "https://[::1]:443", expected: "https://[::1]"},
+		{server: "https://[::1]:8443", expected: "https://[::1]:8443"},
+	}
+
+	for _, tt := range tests {
+		normalized, err := NormalizeServerURL(tt.server)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, normalized, tt.server)
+	}
+
+	_, err := NormalizeServerURL("https://")
+	assert.Error(t, err)
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cli2.json")
+	content := fmt.Sprintf(`{"version": %d, "Servers": {}}`, CurrentVersion+1)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	_, err := LoadFromPath(path)
+	assert.ErrorContains(t, err, "upgrade the rancher CLI")
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	content := `{
+  "Servers": {
+    "rancherDefault": {
+      "url": "https://rancher.example.com",
+      "tokenKey": "token-abcde:secret",
+      "colour": "blue",
+      "kubeCredentials": {"u-abcde_c-12345": null}
+    },
+    "unknown.example.com": {
+      "kubeCredentials": {
+        "u-abcde_c-12345": {"status": {"token": "kubeconfig-u-abcde:kept"}}
+      }
+    }
+  },
+  "CurrentServer": "missing",
+  "Extra": true
+}`
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	credentials := `{"servers": {
+  "https://rancher.example.com": {"u-abcde_c-67890": null},
+  "https://deleted.example.com": {"u-abcde_c-12345": {"status": {"token": "kubeconfig-u-abcde:orphaned"}}}
+}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, credentialsFile), []byte(credentials), 0600))
+
+	problems, err := Validate(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`unknown field "Extra"`,
+		`server rancherDefault: unknown field "colour"`,
+		"current server missing is not configured",
+		"kube credentials of https://deleted.example.com don't belong to a configured server",
+		"kube credential https://rancher.example.com/u-abcde_c-67890 is empty",
+		"kube credentials of https://unknown.example.com don't belong to a configured server",
+	}, problems)
+
+	path = filepath.Join(t.TempDir(), "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(validConfigContent), 0600))
+
+	problems, err = Validate(path)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Overrides select the server, context and cluster used by a single
+// invocation of the CLI. They are applied in memory and never written to the
+// config file.
+type Overrides struct {
+	// Server is the name of a server, or the host of its URL.
+	Server string
+	// Context is a project ID, in the <cluster-id>:<project-id> format.
+	Context string
+	// Cluster is a cluster ID, or a name resolved when the client is created.
+	Cluster string
+}
+
+// contextOverride replaces the context of a ServerConfig in memory.
+type contextOverride struct {
+	cluster string
+	project string
+}
+
+// SetOverrides sets the overrides applied by GetCurrentServer.
+func (c *Config) SetOverrides(o Overrides) {
+	c.overrides = o
+}
+
+// CurrentServerName returns the name of the server in use, which is the
+// current server unless it's overridden.
+func (c Config) CurrentServerName() string {
+	if c.overrides.Server != "" {
+		name, _ := c.LookupServer(c.overrides.Server)
+		return name
+	}
+	return c.CurrentServer
+}
+
+// OverrideContext replaces the context of the server in memory. When only
+// the cluster is given, the current project is kept if it belongs to that
+// cluster, otherwise the project is left empty.
+func (c *ServerConfig) OverrideContext(project, cluster string) error {
+	if project != "" {
+		projectCluster, projectID, ok := strings.Cut(project, ":")
+		if !ok || projectCluster == "" || projectID == "" {
+			return fmt.Errorf("invalid context %q, must be in the <cluster-id>:<project-id> format", project)
+		}
+		if cluster != "" && cluster != projectCluster {
+			return fmt.Errorf("context %s doesn't belong to cluster %s", project, cluster)
+		}
+		cluster = projectCluster
+	} else if current := c.GetCurrentProject(); strings.HasPrefix(current, cluster+":") {
+		project = current
+	}
+
+	c.context = &contextOverride{
+		cluster: cluster,
+		project: project,
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// SecretBackendFile stores secrets in a passphrase-encrypted file next to the config.
+	SecretBackendFile = "file"
+	// SecretBackendKeyring stores secrets in the keyring of the operating system.
+	SecretBackendKeyring = "keyring"
+
+	// secretRefPrefix marks config values that reference an entry of the secret store.
+	secretRefPrefix = "secretref:"
+	// secretsFile is the name of the file used by the file secret store.
+	secretsFile = "secrets.enc"
+	// passphraseEnv holds the passphrase of the file secret store.
+	passphraseEnv = "RANCHER_SECRETS_PASSPHRASE"
+	// redacted replaces the secrets of the config displayed to the user.
+	redacted = "REDACTED"
+)
+
+// ErrSecretNotFound is returned by a SecretStore when the key doesn't exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore persists the sensitive values of the config outside of the config file.
+type SecretStore interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+}
+
+// PassphraseFunc returns the passphrase protecting the file secret store.
+// When confirm is true the store is being created and the passphrase should
+// be asked twice. The default implementation reads RANCHER_SECRETS_PASSPHRASE.
+var PassphraseFunc = func(confirm bool) (string, error) {
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		return "", fmt.Errorf("the secret store passphrase is required, set %s", passphraseEnv)
+	}
+	return passphrase, nil
+}
+
+// passphraseCache keeps the passphrase of the file secret store once it's
+// been asked for, so that it's asked for once per process, however many
+// stores are opened, concurrently or not.
+type passphraseCache struct {
+	mu         sync.Mutex
+	passphrase string
+}
+
+// sharedPassphrase is the passphrase of the file secret stores opened by
+// OpenSecretStore.
+var sharedPassphrase passphraseCache
+
+// get returns the cached passphrase, asking fn for it the first time. Callers
+// wait for the passphrase being asked for by another goroutine.
+func (c *passphraseCache) get(fn func(confirm bool) (string, error), confirm bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.passphrase != "" {
+		return c.passphrase, nil
+	}
+
+	passphrase, err := fn(confirm)
+	if err != nil {
+		return "", err
+	}
+	c.passphrase = passphrase
+	return passphrase, nil
+}
+
+// keyCache keeps the keys derived from the shared passphrase by salt, as
+// deriving one is slow on purpose and each config load opens new stores.
+type keyCache struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+// sharedKeys are the keys of the file secret stores opened by
+// OpenSecretStore.
+var sharedKeys keyCache
+
+func (c *keyCache) get(salt []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[string(salt)]
+}
+
+func (c *keyCache) put(salt, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string][]byte)
+	}
+	c.keys[string(salt)] = key
+}
+
+// SecretBackends lists the names accepted by OpenSecretStore.
+func SecretBackends() []string {
+	return []string{SecretBackendFile, SecretBackendKeyring}
+}
+
+// OpenSecretStore returns the secret store for the given backend. dir is the
+// directory holding the config file.
+func OpenSecretStore(backend, dir string) (SecretStore, error) {
+	switch backend {
+	case SecretBackendFile:
+		store := newFileSecretStore(filepath.Join(dir, secretsFile), func(confirm bool) (string, error) {
+			return sharedPassphrase.get(PassphraseFunc, confirm)
+		})
+		store.keys = &sharedKeys
+		return store, nil
+	case SecretBackendKeyring:
+		return newKeyringSecretStore(keyringServiceFor(dir)), nil
+	default:
+		return nil, fmt.Errorf("unknown secret backend %q, must be one of: %s", backend, strings.Join(SecretBackends(), ", "))
+	}
+}
+
+// secretState tracks the secrets resolved when loading a config, so that
+// writes only touch the entries that changed.
+type secretState struct {
+	backend string
+	store   SecretStore
+	values  map[string]string
+}
+
+// IsSecretRef reports whether value is a reference to the secret store.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretRefPrefix)
+}
+
+func secretRef(key string) string {
+	return secretRefPrefix + key
+}
+
+// walkSecrets calls fn with the store key and a pointer to each sensitive value of the config.
+func (c *Config) walkSecrets(fn func(key string, value *string) error) error {
+	for name, server := range c.Servers {
+		if server == nil {
+			continue
+		}
+		if err := fn(name+"/secretKey", &server.SecretKey); err != nil {
+			return err
+		}
+		if err := fn(name+"/tokenKey", &server.TokenKey); err != nil {
+			return err
+		}
+		for credName, cred := range server.KubeCredentials {
+			if cred == nil || cred.Status == nil {
+				continue
+			}
+			prefix := name + "/kubeCredentials/" + credName
+			if err := fn(prefix+"/token", &cred.Status.Token); err != nil {
+				return err
+			}
+			if err := fn(prefix+"/clientKeyData", &cred.Status.ClientKeyData); err != nil {
+				return err
+			}
+		}
+		for userID, oauthToken := range server.OAuthTokens {
+			if oauthToken == nil {
+				continue
+			}
+			if err := fn(name+"/oauthTokens/"+userID+"/refreshToken", &oauthToken.RefreshToken); err != nil {
+				return err
+			}
+		}
+		for kubeConfigName, kubeConfig := range server.KubeConfigs {
+			if kubeConfig == nil {
+				continue
+			}
+			for authName, authInfo := range kubeConfig.AuthInfos {
+				if authInfo == nil {
+					continue
+				}
+				if err := fn(name+"/kubeConfigs/"+kubeConfigName+"/"+authName+"/token", &authInfo.Token); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSecrets replaces the secret references of the config with the values of the store.
+func (c *Config) resolveSecrets() error {
+	state, err := loadSecrets(c.SecretBackend, filepath.Dir(c.Path), c.walkSecrets)
+	if err != nil {
+		return err
+	}
+	c.secrets = state
+	return nil
+}
+
+// externalizeSecrets moves the secrets of the config to the secret store and
+// returns a copy of the config holding references in their place.
+func (c Config) externalizeSecrets() (Config, func() error, error) {
+	out := c.deepCopy()
+	if c.SecretBackend == "" {
+		// refresh tokens are long-lived, they're never stored in plain text
+		for _, server := range out.Servers {
+			if server != nil {
+				server.OAuthTokens = nil
+			}
+		}
+	}
+
+	cleanup, err := storeSecrets(c.secrets, c.SecretBackend, filepath.Dir(c.Path), out.walkSecrets)
+	return out, cleanup, err
+}
+
+// loadSecrets replaces the secret references found by walk with the values of
+// the store of backend.
+func loadSecrets(backend, dir string, walk func(fn func(key string, value *string) error) error) (*secretState, error) {
+	store, err := OpenSecretStore(backend, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &secretState{
+		backend: backend,
+		store:   store,
+		values:  make(map[string]string),
+	}
+	err = walk(func(key string, value *string) error {
+		if !IsSecretRef(*value) {
+			return nil
+		}
+		key = strings.TrimPrefix(*value, secretRefPrefix)
+		secret, err := store.Get(key)
+		if err != nil {
+			return fmt.Errorf("reading secret %s: %w", key, err)
+		}
+		*value = secret
+		state.values[key] = secret
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// storeSecrets moves the values found by walk to the store of backend,
+// replacing them with references. state holds the secrets loaded before, if
+// any, and the returned func deletes those that are no longer referenced.
+func storeSecrets(state *secretState, backend, dir string, walk func(fn func(key string, value *string) error) error) (func() error, error) {
+	if backend == "" {
+		return state.staleSecretsCleanup(backend, nil), nil
+	}
+
+	var (
+		store SecretStore
+		known map[string]string
+		err   error
+	)
+	if state != nil && state.backend == backend {
+		store, known = state.store, state.values
+	} else {
+		store, err = OpenSecretStore(backend, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	used := make(map[string]bool)
+	err = walk(func(key string, value *string) error {
+		if *value == "" {
+			return nil
+		}
+		if IsSecretRef(*value) {
+			used[strings.TrimPrefix(*value, secretRefPrefix)] = true
+			return nil
+		}
+		if secret, ok := known[key]; !ok || secret != *value {
+			if err := store.Set(key, *value); err != nil {
+				return fmt.Errorf("storing secret %s: %w", key, err)
+			}
+			if known != nil {
+				known[key] = *value
+			}
+		}
+		*value = secretRef(key)
+		used[key] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state.staleSecretsCleanup(backend, used), nil
+}
+
+// staleSecretsCleanup returns a func deleting the secrets loaded from the
+// store that are no longer referenced once saved with backend.
+func (s *secretState) staleSecretsCleanup(backend string, used map[string]bool) func() error {
+	return func() error {
+		if s == nil {
+			return nil
+		}
+		// Secrets migrated to another backend (or back to the config file)
+		// are all stale in the previous store.
+		if s.backend != backend {
+			used = nil
+		}
+		var errs []error
+		for key := range s.values {
+			if used[key] {
+				continue
+			}
+			if err := s.store.Delete(key); err != nil && !errors.Is(err, ErrSecretNotFound) {
+				errs = append(errs, fmt.Errorf("deleting secret %s: %w", key, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// Redacted returns a copy of the config with the secrets replaced by a
+// placeholder, suitable for display.
+func (c Config) Redacted() Config {
+	out := c.deepCopy()
+	out.secrets = nil
+	_ = out.walkSecrets(func(_ string, value *string) error {
+		if *value != "" {
+			*value = redacted
+		}
+		return nil
+	})
+	for _, server := range out.Servers {
+		if server == nil {
+			continue
+		}
+		for _, kubeConfig := range server.KubeConfigs {
+			if kubeConfig == nil {
+				continue
+			}
+			for _, authInfo := range kubeConfig.AuthInfos {
+				if authInfo == nil {
+					continue
+				}
+				if len(authInfo.ClientKeyData) > 0 {
+					authInfo.ClientKeyData = []byte(redacted)
+				}
+				if authInfo.Password != "" {
+					authInfo.Password = redacted
+				}
+			}
+		}
+	}
+	return out
+}
+
+// deepCopy returns a copy of the config that can be modified without
+// altering the original servers.
+func (c Config) deepCopy() Config {
+	out := c
+	out.Servers = make(map[string]*ServerConfig, len(c.Servers))
+	for name, server := range c.Servers {
+		if server == nil {
+			out.Servers[name] = nil
+			continue
+		}
+		sc := *server
+		if server.KubeCredentials != nil {
+			sc.KubeCredentials = make(map[string]*ExecCredential, len(server.KubeCredentials))
+			for key, cred := range server.KubeCredentials {
+				sc.KubeCredentials[key] = cred.deepCopy()
+			}
+		}
+		if server.OAuthTokens != nil {
+			sc.OAuthTokens = make(map[string]*OAuthToken, len(server.OAuthTokens))
+			for key, oauthToken := range server.OAuthTokens {
+				if oauthToken != nil {
+					token := *oauthToken
+					oauthToken = &token
+				}
+				sc.OAuthTokens[key] = oauthToken
+			}
+		}
+		if server.KubeConfigs != nil {
+			sc.KubeConfigs = make(map[string]*api.Config, len(server.KubeConfigs))
+			for key, kubeConfig := range server.KubeConfigs {
+				sc.KubeConfigs[key] = kubeConfig.DeepCopy()
+			}
+		}
+		if server.KubeConfigTokens != nil {
+			sc.KubeConfigTokens = make(map[string]*KubeConfigToken, len(server.KubeConfigTokens))
+			for key, kubeConfigToken := range server.KubeConfigTokens {
+				if kubeConfigToken != nil {
+					token := *kubeConfigToken
+					if kubeConfigToken.ExpiresAt != nil {
+						expiresAt := *kubeConfigToken.ExpiresAt
+						token.ExpiresAt = &expiresAt
+					}
+					kubeConfigToken = &token
+				}
+				sc.KubeConfigTokens[key] = kubeConfigToken
+			}
+		}
+		out.Servers[name] = &sc
+	}
+	return out
+}
+
+func (e *ExecCredential) deepCopy() *ExecCredential {
+	if e == nil {
+		return nil
+	}
+	out := *e
+	if e.Status != nil {
+		status := *e.Status
+		if e.Status.ExpirationTimestamp != nil {
+			ts := *e.Status.ExpirationTimestamp
+			status.ExpirationTimestamp = &ts
+		}
+		out.Status = &status
+	}
+	return &out
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	fileSecretStoreVersion = 1
+	// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-HMAC-SHA512.
+	pbkdf2Iterations = 210000
+	saltSize         = 16
+	keySize          = 32
+)
+
+// encryptedSecrets is the on-disk format of the file secret store.
+type encryptedSecrets struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// fileSecretStore keeps the secrets in a single file encrypted with
+// AES-256-GCM, using a key derived from a passphrase. It doesn't depend on
+// any desktop service, so it works on headless machines.
+type fileSecretStore struct {
+	path       string
+	passphrase func(confirm bool) (string, error)
+
+	// keys caches the keys derived from the passphrase, if not nil
+	keys *keyCache
+
+	key     []byte
+	salt    []byte
+	secrets map[string]string
+}
+
+func newFileSecretStore(path string, passphrase func(confirm bool) (string, error)) *fileSecretStore {
+	return &fileSecretStore{
+		path:       path,
+		passphrase: passphrase,
+	}
+}
+
+func (s *fileSecretStore) Get(key string) (string, error) {
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	value, ok := s.secrets[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (s *fileSecretStore) Set(key, value string) error {
+	return s.modify(func() error {
+		s.secrets[key] = value
+		return nil
+	})
+}
+
+func (s *fileSecretStore) Delete(key string) error {
+	return s.modify(func() error {
+		if _, ok := s.secrets[key]; !ok {
+			return ErrSecretNotFound
+		}
+		delete(s.secrets, key)
+		return nil
+	})
+}
+
+// modify applies fn to the secrets and saves them while holding the lock of
+// the secrets file. The secrets are reloaded first, as the config and the
+// credential store are saved under different locks and both set secrets.
+func (s *fileSecretStore) modify(fn func() error) error {
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.secrets = nil
+	if err := s.load(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if s.key == nil {
+		if err := s.init(); err != nil {
+			return err
+		}
+	}
+	return s.save()
+}
+
+// load decrypts the secrets file, once per store unless reloaded by modify. A missing file is an empty
+// store, its passphrase is only asked for when the first secret is set.
+func (s *fileSecretStore) load() error {
+	if s.secrets != nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.secrets = make(map[string]string)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file encryptedSecrets
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("unmarshaling %s: %w", s.path, err)
+	}
+	if file.Version != fileSecretStoreVersion {
+		return fmt.Errorf("unsupported secrets file version %d", file.Version)
+	}
+
+	// the key is only derived again when the file was recreated with a new salt
+	key := s.key
+	if key == nil || !bytes.Equal(s.salt, file.Salt) {
+		if key = s.cachedKey(file.Salt); key == nil {
+			passphrase, err := s.passphrase(false)
+			if err != nil {
+				return err
+			}
+			if key, err = deriveKey(passphrase, file.Salt); err != nil {
+				return err
+			}
+		}
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return errors.New("unable to decrypt the secret store, wrong passphrase?")
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return fmt.Errorf("unmarshaling secrets: %w", err)
+	}
+	s.key, s.salt, s.secrets = key, file.Salt, secrets
+	s.cacheKey()
+	return nil
+}
+
+// init generates the salt and key of a new secrets file.
+func (s *fileSecretStore) init() error {
+	passphrase, err := s.passphrase(true)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	s.key, s.salt = key, salt
+	s.cacheKey()
+	return nil
+}
+
+// cachedKey returns the key of salt derived by another store, if any.
+func (s *fileSecretStore) cachedKey(salt []byte) []byte {
+	if s.keys == nil {
+		return nil
+	}
+	return s.keys.get(salt)
+}
+
+// cacheKey shares the key of the store with the stores opened later.
+func (s *fileSecretStore) cacheKey() {
+	if s.keys != nil {
+		s.keys.put(s.salt, s.key)
+	}
+}
+
+// save encrypts the secrets with a new nonce and replaces the secrets file.
+func (s *fileSecretStore) save() error {
+	plaintext, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(encryptedSecrets{
+		Version: fileSecretStoreVersion,
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, content)
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha512.New, passphrase, salt, pbkdf2Iterations, keySize)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
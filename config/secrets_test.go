@@ -0,0 +1,270 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func staticPassphrase(passphrase string) func(bool) (string, error) {
+	return func(bool) (string, error) {
+		return passphrase, nil
+	}
+}
+
+func TestFileSecretStore(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), secretsFile)
+
+	store := newFileSecretStore(path, staticPassphrase("correct horse"))
+	_, err := store.Get("missing")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	require.NoError(t, store.Set("server/secretKey", "the-secret-key"))
+	require.NoError(t, store.Set("server/tokenKey", "the-token-key"))
+	require.NoError(t, store.Delete("server/tokenKey"))
+	assert.ErrorIs(t, store.Delete("server/tokenKey"), ErrSecretNotFound)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "the-secret-key")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode())
+
+	reopened := newFileSecretStore(path, staticPassphrase("correct horse"))
+	value, err := reopened.Get("server/secretKey")
+	require.NoError(t, err)
+	assert.Equal(t, "the-secret-key", value)
+	_, err = reopened.Get("server/tokenKey")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	wrong := newFileSecretStore(path, staticPassphrase("wrong"))
+	_, err = wrong.Get("server/secretKey")
+	assert.ErrorContains(t, err, "wrong passphrase")
+}
+
+func TestPassphraseCache(t *testing.T) {
+	t.Parallel()
+
+	var cache passphraseCache
+	_, err := cache.get(func(bool) (string, error) { return "", errors.New("no terminal") }, false)
+	assert.EqualError(t, err, "no terminal")
+
+	// concurrent stores wait for the passphrase asked for once
+	var asked atomic.Int32
+	ask := func(bool) (string, error) {
+		asked.Add(1)
+		return "correct horse", nil
+	}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			passphrase, err := cache.get(ask, false)
+			assert.NoError(t, err)
+			assert.Equal(t, "correct horse", passphrase)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), asked.Load())
+}
+
+func TestFileSecretStoreKeyCache(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), secretsFile)
+	var keys keyCache
+	var asked atomic.Int32
+	passphrase := func(bool) (string, error) {
+		asked.Add(1)
+		return "correct horse", nil
+	}
+
+	store := newFileSecretStore(path, passphrase)
+	store.keys = &keys
+	require.NoError(t, store.Set("server/secretKey", "the-secret-key"))
+	require.Equal(t, int32(1), asked.Load())
+
+	// the key derived by the first store is reused by the next ones
+	reopened := newFileSecretStore(path, passphrase)
+	reopened.keys = &keys
+	value, err := reopened.Get("server/secretKey")
+	require.NoError(t, err)
+	assert.Equal(t, "the-secret-key", value)
+	assert.Equal(t, int32(1), asked.Load())
+}
+
+func TestKeyringServiceFor(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	service := keyringServiceFor(dir)
+	assert.True(t, strings.HasPrefix(service, keyringService+":"), service)
+	assert.Equal(t, service, keyringServiceFor(dir+string(filepath.Separator)))
+	assert.NotEqual(t, service, keyringServiceFor(t.TempDir()))
+}
+
+func TestWriteWithSecretBackend(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(validConfigContent), 0600))
+
+	conf, err := LoadFromPath(path)
+	require.NoError(t, err)
+	conf.Servers["rancherDefault"].KubeConfigs = map[string]*api.Config{
+		"user-cluster": {
+			AuthInfos: map[string]*api.AuthInfo{
+				"cluster": {Token: "kubeconfig-user:the-kube-token"},
+			},
+		},
+	}
+	conf.Servers["rancherDefault"].OAuthTokens = map[string]*OAuthToken{
+		"u-abcde": {AuthProvider: "genericOIDCProvider", RefreshToken: "the-refresh-token"},
+	}
+	conf.SecretBackend = SecretBackendFile
+	require.NoError(t, conf.Write())
+
+	// the in-memory config keeps the values
+	assert.Equal(t, "the-secret-key", conf.Servers["rancherDefault"].SecretKey)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "the-secret-key")
+	assert.NotContains(t, string(content), "the-token-key")
+	assert.NotContains(t, string(content), "the-kube-token")
+	assert.NotContains(t, string(content), "the-refresh-token")
+	assert.Contains(t, string(content), secretRef("rancherDefault/secretKey"))
+
+	conf, err = LoadFromPath(path)
+	require.NoError(t, err)
+	server := conf.Servers["rancherDefault"]
+	assert.Equal(t, "the-access-key", server.AccessKey)
+	assert.Equal(t, "the-secret-key", server.SecretKey)
+	assert.Equal(t, "the-token-key", server.TokenKey)
+	assert.Equal(t, "kubeconfig-user:the-kube-token", server.KubeConfigs["user-cluster"].AuthInfos["cluster"].Token)
+	assert.Equal(t, &OAuthToken{AuthProvider: "genericOIDCProvider", RefreshToken: "the-refresh-token"}, server.OAuthTokens["u-abcde"])
+
+	// removing the server removes its secrets from the store
+	delete(conf.Servers, "rancherDefault")
+	require.NoError(t, conf.Write())
+
+	store := newFileSecretStore(filepath.Join(dir, secretsFile), staticPassphrase("correct horse"))
+	_, err = store.Get("rancherDefault/secretKey")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func TestCredentialStoreWithSecretBackend(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(validConfigContent), 0600))
+
+	conf, err := LoadFromPath(path)
+	require.NoError(t, err)
+	conf.SecretBackend = SecretBackendFile
+	require.NoError(t, conf.Write())
+
+	err = conf.UpdateCredentials(func(s *CredentialStore) error {
+		s.Set("rancher.example.com", "u-abcde_c-12345", &ExecCredential{Status: &ExecCredentialStatus{
+			Token: "kubeconfig-u-abcde:the-kube-token",
+		}})
+		return nil
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(conf.CredentialStorePath())
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "the-kube-token")
+	assert.Contains(t, string(content), secretRef("credentials/https://rancher.example.com/u-abcde_c-12345/token"))
+
+	// the secrets of the config are kept, although saved under another lock
+	conf, err = LoadFromPath(path)
+	require.NoError(t, err)
+	assert.Equal(t, "the-secret-key", conf.Servers["rancherDefault"].SecretKey)
+
+	creds, err := conf.LoadCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-abcde:the-kube-token", creds.Get("https://rancher.example.com", "u-abcde_c-12345").Status.Token)
+
+	// deleting the credential removes its secret from the store
+	err = conf.UpdateCredentials(func(s *CredentialStore) error {
+		s.Delete("rancher.example.com", "u-abcde_c-12345")
+		return nil
+	})
+	require.NoError(t, err)
+
+	store := newFileSecretStore(filepath.Join(dir, secretsFile), staticPassphrase("correct horse"))
+	_, err = store.Get("credentials/https://rancher.example.com/u-abcde_c-12345/token")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func TestWriteMigratesSecretsBackToConfigFile(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse")
+
+	path := filepath.Join(t.TempDir(), "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(validConfigContent), 0600))
+
+	conf, err := LoadFromPath(path)
+	require.NoError(t, err)
+	conf.Servers["rancherDefault"].OAuthTokens = map[string]*OAuthToken{
+		"u-abcde": {AuthProvider: "genericOIDCProvider", RefreshToken: "the-refresh-token"},
+	}
+	conf.SecretBackend = SecretBackendFile
+	require.NoError(t, conf.Write())
+
+	conf, err = LoadFromPath(path)
+	require.NoError(t, err)
+	conf.SecretBackend = ""
+	require.NoError(t, conf.Write())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "the-secret-key")
+	assert.NotContains(t, string(content), secretRefPrefix)
+	// refresh tokens are dropped rather than written in plain text
+	assert.NotContains(t, string(content), "the-refresh-token")
+}
+
+func TestRedacted(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cli2.json")
+	require.NoError(t, os.WriteFile(path, []byte(validConfigContent), 0600))
+
+	conf, err := LoadFromPath(path)
+	require.NoError(t, err)
+	conf.Servers["rancherDefault"].KubeConfigs = map[string]*api.Config{
+		"user-cluster": {
+			AuthInfos: map[string]*api.AuthInfo{
+				"cluster": {Token: "kubeconfig-user:the-kube-token", ClientKeyData: []byte("the-client-key")},
+			},
+		},
+	}
+
+	view := conf.Redacted()
+	server := view.Servers["rancherDefault"]
+	assert.Equal(t, "the-access-key", server.AccessKey)
+	assert.Equal(t, redacted, server.SecretKey)
+	assert.Equal(t, redacted, server.TokenKey)
+	assert.Equal(t, redacted, server.KubeConfigs["user-cluster"].AuthInfos["cluster"].Token)
+	assert.Equal(t, []byte(redacted), server.KubeConfigs["user-cluster"].AuthInfos["cluster"].ClientKeyData)
+
+	// the config itself is left untouched
+	assert.Equal(t, "the-secret-key", conf.Servers["rancherDefault"].SecretKey)
+	assert.Equal(t, "kubeconfig-user:the-kube-token", conf.Servers["rancherDefault"].KubeConfigs["user-cluster"].AuthInfos["cluster"].Token)
+}
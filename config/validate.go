@@ -0,0 +1,163 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Validate checks the config file at path and returns a description of each
+// problem found: fields unknown to this version of the CLI, and entries of the
+// config and of the credential store that can't be used.
+func Validate(path string) ([]string, error) {
+	var problems []string
+
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		unknown, err := unknownFields(content)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshaling %s: %w", path, err)
+		}
+		problems = append(problems, unknown...)
+	}
+
+	cf, err := LoadFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, cf.orphanedEntries()...)
+
+	creds, err := cf.LoadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, creds.orphanedEntries(cf)...)
+
+	legacyPath := filepath.Join(filepath.Dir(path), legacyConfigFile)
+	if _, err := os.Stat(legacyPath); err == nil && content != nil {
+		problems = append(problems, fmt.Sprintf("legacy config %s is not used anymore", legacyPath))
+	}
+
+	return problems, nil
+}
+
+// unknownFields returns the fields of the config file, and of its servers,
+// that don't map to a field of Config and ServerConfig.
+func unknownFields(content []byte) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	var servers map[string]map[string]json.RawMessage
+	if raw, ok := fields["Servers"]; ok {
+		if err := json.Unmarshal(raw, &servers); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+	known := jsonFields(reflect.TypeFor[Config]())
+	for _, field := range sortedKeys(fields) {
+		if !known[strings.ToLower(field)] {
+			problems = append(problems, fmt.Sprintf("unknown field %q", field))
+		}
+	}
+
+	known = jsonFields(reflect.TypeFor[ServerConfig]())
+	for _, name := range sortedKeys(servers) {
+		for _, field := range sortedKeys(servers[name]) {
+			if !known[strings.ToLower(field)] {
+				problems = append(problems, fmt.Sprintf("server %s: unknown field %q", name, field))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// orphanedEntries returns the entries of the config that can't be used.
+func (c Config) orphanedEntries() []string {
+	var problems []string
+
+	if c.CurrentServer != "" && c.Servers[c.CurrentServer] == nil {
+		problems = append(problems, fmt.Sprintf("current server %s is not configured", c.CurrentServer))
+	}
+
+	for _, name := range sortedKeys(c.Servers) {
+		server := c.Servers[name]
+		if server == nil {
+			problems = append(problems, fmt.Sprintf("server %s is empty", name))
+			continue
+		}
+		if server.URL == "" {
+			problems = append(problems, fmt.Sprintf("server %s has no url", name))
+		}
+		for _, key := range sortedKeys(server.KubeConfigs) {
+			if server.KubeConfigs[key] == nil {
+				problems = append(problems, fmt.Sprintf("server %s: kubeconfig %s is empty", name, key))
+			}
+		}
+	}
+
+	return problems
+}
+
+// orphanedEntries returns the entries of the credential store that can't be
+// used: empty ones, and those of servers that aren't configured in c.
+func (s *CredentialStore) orphanedEntries(c Config) []string {
+	configured := make(map[string]bool)
+	for _, server := range c.Servers {
+		if server != nil && server.URL != "" {
+			configured[normalizeServerKey(server.URL)] = true
+		}
+	}
+
+	var problems []string
+	for _, server := range sortedKeys(s.Servers) {
+		if !configured[server] {
+			problems = append(problems, fmt.Sprintf("kube credentials of %s don't belong to a configured server", server))
+		}
+		for _, key := range sortedKeys(s.Servers[server]) {
+			if cred := s.Servers[server][key]; cred == nil || cred.Status == nil {
+				problems = append(problems, fmt.Sprintf("kube credential %s/%s is empty", server, key))
+			}
+		}
+	}
+	return problems
+}
+
+// jsonFields returns the lowercased names of the JSON fields of the struct t,
+// as encoding/json matches them case-insensitively.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = true
+	}
+	return fields
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
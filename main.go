@@ -83,6 +83,8 @@ func mainErr() error {
 				logrus.SetLevel(logrus.DebugLevel)
 			}
 
+			config.PassphraseFunc = cmd.SecretsPassphrase
+
 			path := cmd.GetConfigPath(c)
 			warnings, err := config.GetFilePermissionWarnings(path)
 			if err != nil {
@@ -93,6 +95,8 @@ func mainErr() error {
 				logrus.Warning(warning)
 			}
 
+			cmd.SweepSecretFiles(c)
+
 			return ctx, nil
 		},
 		Flags: []cli.Flag{
@@ -107,23 +111,45 @@ func mainErr() error {
 				Sources: cli.EnvVars("RANCHER_CONFIG_DIR"),
 				Value:   configDir,
 			},
+			&cli.StringFlag{
+				Name:    "server",
+				Usage:   "Name, host or URL of the server to use instead of the current server, the config file isn't changed",
+				Sources: cli.EnvVars("RANCHER_SERVER"),
+			},
+			&cli.StringFlag{
+				Name:    "context",
+				Usage:   "Project ID (<cluster-id>:<project-id>) to use instead of the current context, the config file isn't changed",
+				Sources: cli.EnvVars("RANCHER_CONTEXT"),
+			},
+			&cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster ID or name to use instead of the cluster of the current context, the config file isn't changed",
+			},
 		},
 		Commands: []*cli.Command{
+			cmd.APITokenCommand(),
 			cmd.ClusterCommand(),
+			cmd.ConfigCommand(),
 			cmd.ContextCommand(),
+			cmd.ExecKubeCommand(),
 			cmd.InspectCommand(),
+			cmd.KubeconfigCommand(),
 			cmd.KubectlCommand(),
 			cmd.LoginCommand(),
+			cmd.LogoutCommand(),
 			cmd.MachineCommand(),
 			cmd.NamespaceCommand(),
 			cmd.NodeCommand(),
 			cmd.ProjectCommand(),
+			cmd.ProxyCommand(),
 			cmd.PsCommand(),
 			cmd.ServerCommand(),
 			cmd.SettingsCommand(),
+			cmd.ShellCommand(),
 			cmd.SSHCommand(),
 			cmd.UpCommand(),
 			cmd.WaitCommand(),
+			cmd.WhoamiCommand(),
 			cmd.CredentialCommand(),
 		},
 	}